@@ -0,0 +1,220 @@
+package rsh
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jhump/grpctunnel"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// Version is the agent version reported to the reverse tunnel server.
+// Set it at build time with -ldflags "-X github.com/nxsre/go-rsh.Version=v1.2.3".
+var Version = "dev"
+
+// AgentInfo describes a reverse tunnel agent connected to a ReverseServer.
+type AgentInfo struct {
+	ClientID     string            `json:"client_id"`
+	PeerAddr     string            `json:"peer_addr"`
+	CertCN       string            `json:"cert_cn,omitempty"`
+	ConnectedAt  time.Time         `json:"connected_at"`
+	LastActivity time.Time         `json:"last_activity"`
+	Hostname     string            `json:"hostname,omitempty"`
+	OS           string            `json:"os,omitempty"`
+	Arch         string            `json:"arch,omitempty"`
+	Version      string            `json:"version,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+}
+
+// WithLabels sets the labels a reverse tunnel agent advertises to the server, used by fan-out selectors.
+func WithLabels(labels map[string]string) ServerOption {
+	return func(o *serverOptions) {
+		o.labels = labels
+	}
+}
+
+// agentMetadata 返回 agent 注册反向隧道时上报的 metadata
+func agentMetadata(clientID string, labels map[string]string) metadata.MD {
+	hostname, _ := os.Hostname()
+	md := metadata.Pairs(
+		"client-id", clientID,
+		"service", "rsh",
+		"hostname", hostname,
+		"os", runtime.GOOS,
+		"arch", runtime.GOARCH,
+		"version", Version,
+	)
+	if len(labels) > 0 {
+		md.Set("labels", formatLabels(labels))
+	}
+	return md
+}
+
+// ParseLabels parses labels written as "k1=v1,k2=v2".
+func ParseLabels(s string) (map[string]string, error) {
+	labels := map[string]string{}
+	for _, kv := range strings.Split(s, ",") {
+		kv = strings.TrimSpace(kv)
+		if kv == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" || strings.ContainsAny(k, "!=") {
+			return nil, fmt.Errorf("invalid label %q: expected key=value", kv)
+		}
+		labels[k] = v
+	}
+	return labels, nil
+}
+
+// formatLabels 按 key 排序格式化为 "k1=v1,k2=v2"
+func formatLabels(labels map[string]string) string {
+	kvs := make([]string, 0, len(labels))
+	for k, v := range labels {
+		kvs = append(kvs, k+"="+v)
+	}
+	sort.Strings(kvs)
+	return strings.Join(kvs, ",")
+}
+
+// agent 是一个已连接的 agent，调用其反向隧道时更新最后活动时间
+type agent struct {
+	grpc.ClientConnInterface
+	channel      grpctunnel.TunnelChannel
+	info         AgentInfo
+	lastActivity atomic.Int64 // UnixNano
+}
+
+func newAgent(clientID string, channel grpctunnel.TunnelChannel) *agent {
+	ctx := channel.Context()
+	a := &agent{
+		ClientConnInterface: channel,
+		channel:             channel,
+		info: AgentInfo{
+			ClientID:    clientID,
+			ConnectedAt: time.Now(),
+		},
+	}
+	a.touch()
+
+	if p, ok := peer.FromContext(ctx); ok {
+		a.info.PeerAddr = p.Addr.String()
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(tlsInfo.State.PeerCertificates) > 0 {
+			a.info.CertCN = tlsInfo.State.PeerCertificates[0].Subject.CommonName
+		}
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	get := func(key string) string {
+		if v := md.Get(key); len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+	a.info.Hostname = get("hostname")
+	a.info.OS = get("os")
+	a.info.Arch = get("arch")
+	a.info.Version = get("version")
+	if labels, err := ParseLabels(get("labels")); err == nil && len(labels) > 0 {
+		a.info.Labels = labels
+	}
+	return a
+}
+
+func (a *agent) touch() {
+	a.lastActivity.Store(time.Now().UnixNano())
+}
+
+func (a *agent) Info() AgentInfo {
+	info := a.info
+	info.LastActivity = time.Unix(0, a.lastActivity.Load())
+	return info
+}
+
+func (a *agent) Invoke(ctx context.Context, method string, args, reply any, opts ...grpc.CallOption) error {
+	a.touch()
+	defer a.touch()
+	return a.ClientConnInterface.Invoke(ctx, method, args, reply, opts...)
+}
+
+func (a *agent) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	a.touch()
+	stream, err := a.ClientConnInterface.NewStream(ctx, desc, method, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &agentStream{ClientStream: stream, agent: a}, nil
+}
+
+// agentStream 在收发消息时更新 agent 的最后活动时间
+type agentStream struct {
+	grpc.ClientStream
+	agent *agent
+}
+
+func (s *agentStream) SendMsg(m any) error {
+	s.agent.touch()
+	return s.ClientStream.SendMsg(m)
+}
+
+func (s *agentStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	s.agent.touch()
+	return err
+}
+
+// ListClients returns the connected agents sorted by client-id.
+func (s *ReverseServer) ListClients() []AgentInfo {
+	var infos []AgentInfo
+	s.clients.ForEach(func(id string, a *agent) bool {
+		info := a.Info()
+		// 同一个 agent 可能以多个 id 注册，按注册的 id 返回
+		info.ClientID = id
+		infos = append(infos, info)
+		return true
+	})
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ClientID < infos[j].ClientID
+	})
+	return infos
+}
+
+// ClientInfo returns the agent registered as id, or false if it is not connected.
+func (s *ReverseServer) ClientInfo(id string) (AgentInfo, bool) {
+	a, ok := s.clients.Get(id)
+	if !ok {
+		return AgentInfo{}, false
+	}
+	info := a.Info()
+	info.ClientID = id
+	return info, true
+}
+
+// handleListAgents 处理 GET /agents
+func (s *ReverseServer) handleListAgents(c *gin.Context) {
+	agents := s.ListClients()
+	if agents == nil {
+		agents = []AgentInfo{}
+	}
+	NewResult(c).Success(agents)
+}
+
+// handleGetAgent 处理 GET /agents/:id
+func (s *ReverseServer) handleGetAgent(c *gin.Context) {
+	info, ok := s.ClientInfo(c.Param("id"))
+	if !ok {
+		NewResult(c).ErrorCode(404, "资源未找到", nil)
+		return
+	}
+	NewResult(c).Success(info)
+}
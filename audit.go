@@ -0,0 +1,154 @@
+package rsh
+
+import (
+	"encoding/json"
+	"log/slog"
+	"log/syslog"
+	"os"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/peer"
+)
+
+// AuditRecord 是一次会话的审计记录，会话结束时生成。
+type AuditRecord struct {
+	SessionID     string    `json:"session_id"`
+	PeerAddr      string    `json:"peer_addr"`
+	Identity      string    `json:"identity"`               // 调用方身份: token subject 或证书 CN
+	TLSIdentity   string    `json:"tls_identity,omitempty"` // 客户端证书 CN
+	ClientID      string    `json:"client_id,omitempty"`    // 作为反向隧道 agent 运行时的 client-id
+	User          string    `json:"user,omitempty"`         // 运行命令的本地用户，为空时为服务端进程的用户
+	Profile       string    `json:"profile,omitempty"`      // 运行命令的沙箱 profile
+	TargetPid     int       `json:"target_pid,omitempty"`   // 在该进程的 namespace 中运行命令
+	Command       string    `json:"command"`
+	Args          []string  `json:"args"`
+	Terminal      bool      `json:"terminal"`
+	StartTime     time.Time `json:"start_time"`
+	EndTime       time.Time `json:"end_time"`
+	ExitCode      int       `json:"exit_code"` // 命令未结束(连接断开、被拒绝等)时为 -1
+	TimedOut      bool      `json:"timed_out,omitempty"`
+	LimitExceeded string    `json:"limit_exceeded,omitempty"` // 命令因超过资源限制被终止: memory、cpu 或 wall-time
+	BytesIn       int64     `json:"bytes_in"`                 // 客户端发送的输入字节数
+	BytesOut      int64     `json:"bytes_out"`                // 返回给客户端的输出字节数
+	Error         string    `json:"error,omitempty"`
+	Recording     string    `json:"recording,omitempty"` // 终端会话录像文件
+}
+
+// AuditSink 接收审计记录，实现需要支持并发调用。
+type AuditSink interface {
+	WriteAudit(record *AuditRecord) error
+}
+
+// WithAuditSink 在每个会话结束时向 sinks 写入审计记录。
+func WithAuditSink(sinks ...AuditSink) ServerOption {
+	return func(o *serverOptions) {
+		o.auditSinks = append(o.auditSinks, sinks...)
+	}
+}
+
+// JSONFileAuditSink 以 JSON lines 格式追加写入审计记录。
+type JSONFileAuditSink struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// NewJSONFileAuditSink 打开(或创建)审计日志文件 path。
+func NewJSONFileAuditSink(path string) (*JSONFileAuditSink, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &JSONFileAuditSink{f: f}, nil
+}
+
+func (s *JSONFileAuditSink) WriteAudit(record *AuditRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.f.Write(append(data, '\n'))
+	return err
+}
+
+func (s *JSONFileAuditSink) Close() error {
+	return s.f.Close()
+}
+
+// SyslogAuditSink 以 JSON 格式向本机 syslog 的 authpriv facility 写入审计记录。
+type SyslogAuditSink struct {
+	w *syslog.Writer
+}
+
+// NewSyslogAuditSink 连接本机 syslog，tag 为空时使用程序名。
+func NewSyslogAuditSink(tag string) (*SyslogAuditSink, error) {
+	w, err := syslog.New(syslog.LOG_INFO|syslog.LOG_AUTHPRIV, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &SyslogAuditSink{w: w}, nil
+}
+
+func (s *SyslogAuditSink) WriteAudit(record *AuditRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return s.w.Info(string(data))
+}
+
+func (s *SyslogAuditSink) Close() error {
+	return s.w.Close()
+}
+
+// audit 在会话结束后生成审计记录，err 为 session.start 的返回值
+func (s *rshServer) audit(sess *session, err error) {
+	if len(s.auditSinks) == 0 {
+		return
+	}
+
+	ctx := sess.stream.Context()
+	record := &AuditRecord{
+		SessionID:     sess.id,
+		Identity:      callerIdentity(ctx),
+		ClientID:      s.clientID,
+		Command:       sess.command,
+		Args:          sess.args,
+		Terminal:      sess.terminal,
+		StartTime:     sess.startTime,
+		EndTime:       time.Now(),
+		ExitCode:      sess.exitCode,
+		TimedOut:      sess.timedOut.Load(),
+		Profile:       sess.sandboxName,
+		LimitExceeded: sess.limit,
+		BytesIn:       sess.stream.in.Load(),
+		BytesOut:      sess.stream.out.Load(),
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		record.PeerAddr = p.Addr.String()
+	}
+	if id, ok := IdentityFromContext(ctx); ok {
+		record.TLSIdentity = id.CommonName
+	}
+	if sess.account != nil {
+		record.User = sess.account.name
+	}
+	if sess.target != nil {
+		record.TargetPid = sess.target.pid
+	}
+	if sess.recorder != nil {
+		record.Recording = sess.recorder.Path()
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+
+	for _, sink := range s.auditSinks {
+		if err := sink.WriteAudit(record); err != nil {
+			slog.Error("Error writing audit record:", slog.String("session", sess.id), slog.Any("err", err))
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package rsh
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// ServerOption configures a Server.
+type ServerOption func(*serverOptions)
+
+type serverOptions struct {
+	tlsconfig    *tls.Config
+	allowClients []string          // 允许的客户端证书 CN/SAN，为空时不限制
+	tokens       map[string]string // bearer token -> subject
+	policy       *PolicyEngine
+	auditSinks   []AuditSink
+	recordDir    string // 终端会话录像目录，为空时不录像
+	recordInput  bool
+	// 可分离会话，sessionIdleTimeout 为 0 时终端会话随连接结束
+	sessionBuffer      int
+	sessionIdleTimeout time.Duration
+	// 端口转发的目标限制
+	forwardAllow []DestinationRule
+	forwardDeny  []DestinationRule
+	labels       map[string]string // 作为反向隧道 agent 运行时上报的标签
+	userMap      *UserMap          // 允许以其他本地用户运行命令，为 nil 时只能以服务端进程的用户运行
+	sandbox      *SandboxConfig    // 会话可以使用的沙箱 profile，为 nil 时不使用沙箱
+	limits       *ResourceLimits   // 命令的资源限制，为 nil 时不限制
+}
+
+// WithTLS 启用 TLS 并要求客户端证书，cfg 需要配置 ClientCAs。
+// allowClients 不为空时，客户端证书的 CN 或 SAN 必须在其中。
+func WithTLS(cfg *tls.Config, allowClients []string) ServerOption {
+	return func(o *serverOptions) {
+		o.tlsconfig = cfg.Clone()
+		o.tlsconfig.ClientAuth = tls.RequireAndVerifyClientCert
+		o.allowClients = allowClients
+	}
+}
+
+// WithTokens 要求每个请求携带 "authorization: Bearer <token>"，tokens 为 token 到 subject 的映射。
+func WithTokens(tokens map[string]string) ServerOption {
+	return func(o *serverOptions) {
+		o.tokens = tokens
+	}
+}
+
+// WithPolicy 在执行命令和传输文件前按策略授权。
+func WithPolicy(policy *PolicyEngine) ServerOption {
+	return func(o *serverOptions) {
+		o.policy = policy
+	}
+}
+
+// LoadTokens 读取 token 文件，每行为 "<token> <subject>"，# 开头的行为注释。
+func LoadTokens(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tokens := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected \"<token> <subject>\"", path, n)
+		}
+		tokens[fields[0]] = fields[1]
+	}
+	return tokens, scanner.Err()
+}
+
+// Identity 是经过认证的调用方身份。
+type Identity struct {
+	CommonName string   // 客户端证书的 CN
+	Names      []string // 客户端证书的 CN 和 SAN
+	Subject    string   // bearer token 对应的 subject
+}
+
+// Name 返回用于授权和日志的身份名，优先使用 token subject，其次是证书 CN。
+func (i *Identity) Name() string {
+	if i == nil {
+		return ""
+	}
+	if i.Subject != "" {
+		return i.Subject
+	}
+	return i.CommonName
+}
+
+type identityKey struct{}
+
+// IdentityFromContext 返回服务端拦截器认证得到的调用方身份。
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(*Identity)
+	return id, ok
+}
+
+func (o *serverOptions) authenticate(ctx context.Context) (context.Context, error) {
+	id := &Identity{}
+
+	if p, ok := peer.FromContext(ctx); ok {
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(tlsInfo.State.PeerCertificates) > 0 {
+			cert := tlsInfo.State.PeerCertificates[0]
+			id.CommonName = cert.Subject.CommonName
+			id.Names = certificateNames(cert)
+		}
+	}
+
+	if o.tlsconfig != nil && len(o.allowClients) > 0 && !containsAny(o.allowClients, id.Names) {
+		return nil, status.Errorf(codes.PermissionDenied, "client certificate %q is not allowed", id.CommonName)
+	}
+
+	if o.tokens != nil {
+		subject, ok := o.checkToken(ctx)
+		if !ok {
+			return nil, status.Error(codes.Unauthenticated, "invalid or missing bearer token")
+		}
+		id.Subject = subject
+	}
+
+	return context.WithValue(ctx, identityKey{}, id), nil
+}
+
+func (o *serverOptions) checkToken(ctx context.Context) (string, bool) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		token, ok := strings.CutPrefix(v, "Bearer ")
+		if !ok {
+			continue
+		}
+		if subject, ok := matchToken(o.tokens, token); ok {
+			return subject, true
+		}
+	}
+	return "", false
+}
+
+// matchToken 返回 token 对应的 subject，比较时间与 token 内容无关
+func matchToken(tokens map[string]string, token string) (string, bool) {
+	for t, subject := range tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return subject, true
+		}
+	}
+	return "", false
+}
+
+func (o *serverOptions) unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx, err := o.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (o *serverOptions) streamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx, err := o.authenticate(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &contextServerStream{ServerStream: ss, ctx: ctx})
+}
+
+// contextServerStream 替换 grpc.ServerStream 的 Context
+type contextServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextServerStream) Context() context.Context {
+	return s.ctx
+}
+
+// certificateNames 返回证书的 CN 和所有 SAN
+func certificateNames(cert *x509.Certificate) []string {
+	names := []string{cert.Subject.CommonName}
+	names = append(names, cert.DNSNames...)
+	names = append(names, cert.EmailAddresses...)
+	for _, ip := range cert.IPAddresses {
+		names = append(names, ip.String())
+	}
+	for _, u := range cert.URIs {
+		names = append(names, u.String())
+	}
+	return names
+}
+
+// tokenCredentials 在每个请求中携带 bearer token
+type tokenCredentials struct {
+	token      string
+	requireTLS bool
+}
+
+func (t tokenCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + t.token}, nil
+}
+
+func (t tokenCredentials) RequireTransportSecurity() bool {
+	return t.requireTLS
+}
+
+func containsAny[T comparable](elems []T, vs []T) bool {
+	for _, v := range vs {
+		if contains(elems, v) {
+			return true
+		}
+	}
+	return false
+}
@@ -2,6 +2,8 @@ package rsh
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"github.com/nxsre/go-rsh/pb"
 	"io"
@@ -9,7 +11,9 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/creack/pty"
 	"github.com/mattn/go-tty"
@@ -17,12 +21,15 @@ import (
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
 )
 
 // Client is the remote shell client.
 type Client struct {
 	server   string
 	creds    credentials.TransportCredentials
+	perRPC   credentials.PerRPCCredentials
+	target   string // 经由跳板机访问的 agent client-id
 	ttyState *term.State
 }
 
@@ -34,12 +41,77 @@ func NewClientInsecure(server string) *Client {
 	}
 }
 
+// NewClientTLS creates a client that connects over TLS.
+// The server certificate is verified against tlscfg.ServerName, or the host of server when it is empty.
+func NewClientTLS(server string, tlscfg *tls.Config) *Client {
+	return &Client{
+		server: server,
+		creds:  credentials.NewTLS(tlscfg),
+	}
+}
+
+// NewClientToken creates a client that sends a bearer token with every call over TLS.
+// tlscfg may only be nil for unix socket addresses ("unix:..."); calls to other addresses then fail
+// instead of sending the token in plaintext, see NewClientTokenInsecure.
+func NewClientToken(server string, tlscfg *tls.Config, token string) *Client {
+	if tlscfg == nil {
+		c := NewClientInsecure(server)
+		c.perRPC = tokenCredentials{token: token, requireTLS: !strings.HasPrefix(server, "unix:")}
+		return c
+	}
+	c := NewClientTLS(server, tlscfg)
+	c.perRPC = tokenCredentials{token: token, requireTLS: true}
+	return c
+}
+
+// NewClientTokenInsecure creates a client that sends a bearer token in plaintext with every call.
+// Anyone who can observe the connection can reuse the token, so only use it on trusted networks.
+func NewClientTokenInsecure(server, token string) *Client {
+	c := NewClientInsecure(server)
+	c.perRPC = tokenCredentials{token: token}
+	return c
+}
+
 // ExecOptions are the options for Exec.
 type ExecOptions struct {
 	Terminal       bool
 	Command        string
 	Args           []string
 	CombinedOutput bool
+	// Timeout 为 0 时不限制，超时后服务端结束整个进程组，退出码为 124
+	Timeout time.Duration
+	// Env 为附加的环境变量，终端模式下未指定 TERM 时使用本地的 TERM
+	Env      map[string]string
+	Dir      string // 远端工作目录
+	ClearEnv bool   // 不继承服务端的环境变量
+	// Stdin 非终端模式下发送给远端命令的标准输入，读到 EOF 后关闭远端的 stdin
+	Stdin io.Reader
+	// SeparateStderr 终端模式下为 stderr 单独分配 pty，分别写到本地的 stdout 和 stderr
+	SeparateStderr bool
+	// Stdout 和 Stderr 接收远端命令的输出，为 nil 时使用 os.Stdout 和 os.Stderr
+	Stdout io.Writer
+	Stderr io.Writer
+	// User 以该服务端本地用户运行命令，需要服务端的用户映射允许，为空时以服务端进程的用户运行
+	User string
+	// Login 以用户的登录 shell 运行: 未指定 Command 时启动登录 shell，否则通过 shell -l -c 运行命令
+	Login bool
+	// Profile 在服务端配置的沙箱 profile 中运行命令，为空时使用服务端的默认 profile
+	Profile string
+	// TargetPid 或 TargetCgroup 在该进程或 cgroup 中第一个进程的 namespace 中运行命令，类似 nsenter
+	TargetPid    int
+	TargetCgroup string
+	// TargetNamespaces 为进入的 namespace: mnt、net、pid、uts、ipc，为空时进入全部
+	TargetNamespaces []string
+}
+
+// TransferOptions are the options for Upload and Download.
+type TransferOptions struct {
+	Recursive bool // 递归传输目录
+	Preserve  bool // 保留修改时间，以 root 运行时保留属主
+	// User 以服务端的该本地用户读写文件，与 ExecOptions.User 一样需要服务端的用户映射允许
+	User string
+	// Progress 在每个数据块传输后调用，path 为本地路径
+	Progress func(path string, written, size int64)
 }
 
 // Exec executes a command in the server.
@@ -50,9 +122,9 @@ func (c *Client) Exec(opts *ExecOptions) (*int, error) {
 // ExecContext is like Exec, but with context.
 func (c *Client) ExecContext(ctx context.Context, opts *ExecOptions) (*int, error) {
 
-	conn, err := grpc.NewClient(c.server, grpc.WithTransportCredentials(c.creds))
+	conn, err := c.dial()
 	if err != nil {
-		return nil, fmt.Errorf("dial: %v", err)
+		return nil, err
 	}
 	defer conn.Close()
 
@@ -66,56 +138,254 @@ func (c *Client) ExecContext(ctx context.Context, opts *ExecOptions) (*int, erro
 	if opts == nil {
 		opts = &ExecOptions{}
 	}
+	stdout, stderr := opts.Stdout, opts.Stderr
+	if stdout == nil {
+		stdout = os.Stdout
+	}
+	if stderr == nil {
+		stderr = os.Stderr
+	}
 
-	err = stream.Send(&pb.Input{
-		Start:          true,
-		Command:        opts.Command,
-		Args:           opts.Args,
-		Terminal:       opts.Terminal, // 终端交互模式
-		CombinedOutput: opts.CombinedOutput,
-	})
+	in := &pb.Input{
+		Start:            true,
+		Command:          opts.Command,
+		Args:             opts.Args,
+		Terminal:         opts.Terminal, // 终端交互模式
+		CombinedOutput:   opts.CombinedOutput,
+		Env:              opts.Env,
+		Dir:              opts.Dir,
+		ClearEnv:         opts.ClearEnv,
+		Stdin:            !opts.Terminal && opts.Stdin != nil,
+		SeparateStderr:   opts.SeparateStderr,
+		User:             opts.User,
+		Login:            opts.Login,
+		Profile:          opts.Profile,
+		TargetPid:        int32(opts.TargetPid),
+		TargetCgroup:     opts.TargetCgroup,
+		TargetNamespaces: opts.TargetNamespaces,
+	}
+	if _, ok := opts.Env["TERM"]; opts.Terminal && !ok && os.Getenv("TERM") != "" {
+		in.Env = map[string]string{"TERM": os.Getenv("TERM")}
+		for k, v := range opts.Env {
+			in.Env[k] = v
+		}
+	}
+	if opts.Timeout > 0 {
+		in.Timeout = opts.Timeout.String()
+	}
+
+	err = stream.Send(in)
 	if err != nil {
 		return nil, fmt.Errorf("send cmd: %v", err)
 	}
 
 	if opts.Terminal {
-		var (
-			inc  = make(chan rune, 1024)
-			sigc = make(chan os.Signal, 1)
-		)
+		c.forwardTerminal(stream)
+		defer c.restoreTTY()
+	} else if opts.Stdin != nil {
+		go c.sendStdin(stream, opts.Stdin)
+	}
 
-		signal.Notify(sigc,
-			syscall.SIGWINCH,
-			syscall.SIGHUP,
-			syscall.SIGINT,
-			syscall.SIGQUIT,
-			syscall.SIGTERM,
-			syscall.SIGCHLD,
-		)
+	if opts.CombinedOutput {
+		// 服务端在命令结束后一次性返回输出和退出码，没有 Exited 时命令未执行完成
+		output := &pb.Output{}
+		if err := stream.RecvMsg(output); err != nil && err != io.EOF {
+			return nil, err
+		}
+		if !output.Exited {
+			return nil, errors.New("session closed before the command exited")
+		}
+		stdout.Write(output.CombinedOutput)
+		printExitReason(stderr, output)
+		var exitCode int = int(output.ExitCode)
+		return &exitCode, nil
+	}
 
-		go c.readTTY(stream.Context(), inc)
+	return c.readStream(stream, stdout, stderr)
+}
+
+// DetachedError is returned when the connection to a detachable session is lost.
+// The session keeps running on the server and can be reattached with Attach.
+type DetachedError struct {
+	SessionID string
+	Err       error
+}
 
+func (e *DetachedError) Error() string {
+	return fmt.Sprintf("session %s detached: %v", e.SessionID, e.Err)
+}
+
+func (e *DetachedError) Unwrap() error {
+	return e.Err
+}
+
+// Attach attaches the local terminal to a detachable session, replaying its buffered output.
+// Several clients can attach to the same session; readOnly clients only watch the output.
+func (c *Client) Attach(ctx context.Context, sessionID string, readOnly bool) (*int, error) {
+	conn, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	stream, err := pb.NewRemoteShellClient(conn).Attach(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("attach session: %v", err)
+	}
+
+	if err := stream.Send(&pb.Input{SessionId: sessionID, ReadOnly: readOnly}); err != nil {
+		return nil, fmt.Errorf("send session id: %v", err)
+	}
+	// 服务端先返回会话 ID，会话不存在时在打开终端前返回错误
+	if _, err := stream.Recv(); err != nil {
+		return nil, fmt.Errorf("attach session: %v", err)
+	}
+
+	// 只读时不转发输入，本地终端保持原样，Ctrl-C 即可离开
+	if !readOnly {
+		c.forwardTerminal(stream)
 		defer c.restoreTTY()
+	}
+
+	exitCode, err := c.readStream(stream, os.Stdout, os.Stderr)
+	if _, ok := err.(*DetachedError); err != nil && !ok {
+		err = &DetachedError{SessionID: sessionID, Err: err}
+	}
+	return exitCode, err
+}
 
-		go c.writeStream(stream, inc, sigc)
+// ListSessions lists the detachable sessions of the caller on the server.
+func (c *Client) ListSessions(ctx context.Context) ([]*pb.SessionInfo, error) {
+	conn, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
 
-		sigc <- syscall.SIGWINCH
+	list, err := pb.NewRemoteShellClient(conn).ListSessions(ctx, &pb.ListSessionsRequest{})
+	if err != nil {
+		return nil, err
 	}
+	return list.Sessions, nil
+}
 
-	if opts.CombinedOutput {
-		output := &pb.Output{}
-		err := stream.RecvMsg(output)
-		if err != nil {
-			if err != io.EOF {
-				slog.Info("WARNING: stream.RecvMsg:", slog.Any("err", err))
-			}
-		}
-		os.Stdout.Write(output.CombinedOutput)
-		var a = 0
-		return &a, nil
+// KillSession sends sig (SIGHUP when 0) to a detachable session and removes it once the command exits.
+func (c *Client) KillSession(ctx context.Context, sessionID string, sig syscall.Signal) (*pb.SessionInfo, error) {
+	conn, err := c.dial()
+	if err != nil {
+		return nil, err
 	}
+	defer conn.Close()
 
-	return c.readStream(stream)
+	return pb.NewRemoteShellClient(conn).KillSession(ctx, &pb.KillSessionRequest{SessionId: sessionID, Signal: int32(sig)})
+}
+
+// ForwardLocal listens on listenAddr and forwards every connection to remoteAddr as seen from the server, like ssh -L.
+func (c *Client) ForwardLocal(ctx context.Context, listenAddr, remoteAddr string) error {
+	conn, err := c.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return ForwardLocal(ctx, conn, listenAddr, remoteAddr)
+}
+
+// ForwardRemote listens on remoteListenAddr on the server and forwards every connection to localAddr, like ssh -R.
+func (c *Client) ForwardRemote(ctx context.Context, remoteListenAddr, localAddr string) error {
+	conn, err := c.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return ForwardRemote(ctx, conn, remoteListenAddr, localAddr)
+}
+
+// ServeSOCKS runs a local SOCKS5 server on listenAddr that opens connections from the server, like ssh -D.
+func (c *Client) ServeSOCKS(ctx context.Context, listenAddr string) error {
+	conn, err := c.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return ServeSOCKS(ctx, conn, listenAddr)
+}
+
+// Upload copies the local file or directory localPath to remotePath on the server.
+func (c *Client) Upload(ctx context.Context, localPath, remotePath string, opts *TransferOptions) error {
+	conn, err := c.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = UploadFile(ctx, conn, localPath, remotePath, opts)
+	return err
+}
+
+// Download copies the file or directory remotePath on the server to localPath.
+func (c *Client) Download(ctx context.Context, remotePath, localPath string, opts *TransferOptions) error {
+	conn, err := c.dial()
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return DownloadFile(ctx, conn, remotePath, localPath, opts)
+}
+
+// SetJumpTarget makes the client reach agent clientID through the server, a reverse tunnel
+// server with jump enabled, like ssh -J. The client must connect with a client certificate.
+func (c *Client) SetJumpTarget(clientID string) {
+	c.target = clientID
+}
+
+func (c *Client) dial() (*grpc.ClientConn, error) {
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(c.creds)}
+	if c.perRPC != nil {
+		opts = append(opts, grpc.WithPerRPCCredentials(c.perRPC))
+	}
+	if c.target != "" {
+		opts = append(opts,
+			grpc.WithChainUnaryInterceptor(func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+				return invoker(metadata.AppendToOutgoingContext(ctx, jumpTargetKey, c.target), method, req, reply, cc, opts...)
+			}),
+			grpc.WithChainStreamInterceptor(func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+				return streamer(metadata.AppendToOutgoingContext(ctx, jumpTargetKey, c.target), desc, cc, method, opts...)
+			}),
+		)
+	}
+
+	conn, err := grpc.NewClient(c.server, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("dial: %v", err)
+	}
+	return conn, nil
+}
+
+// forwardTerminal 将本地终端设为 raw 模式并转发输入和信号，调用方需要 restoreTTY
+func (c *Client) forwardTerminal(stream pb.RemoteShell_SessionClient) {
+	var (
+		inc  = make(chan rune, 1024)
+		sigc = make(chan os.Signal, 1)
+	)
+
+	signal.Notify(sigc,
+		syscall.SIGWINCH,
+		syscall.SIGHUP,
+		syscall.SIGINT,
+		syscall.SIGQUIT,
+		syscall.SIGTERM,
+		syscall.SIGCHLD,
+	)
+
+	go c.readTTY(stream.Context(), inc)
+
+	go c.writeStream(stream, inc, sigc)
+
+	sigc <- syscall.SIGWINCH
 }
 
 func (c *Client) readTTY(ctx context.Context, inc chan<- rune) {
@@ -159,7 +429,18 @@ func (c *Client) restoreTTY() {
 	slog.Info("Restored old terminal state")
 }
 
-func (c *Client) readStream(stream pb.RemoteShell_SessionClient) (*int, error) {
+// printExitReason 输出命令被服务端终止的原因
+func printExitReason(w io.Writer, out *pb.Output) {
+	switch {
+	case out.LimitExceeded != "":
+		fmt.Fprintf(w, "rsh: command killed: %s limit exceeded\n", out.LimitExceeded)
+	case out.TimedOut:
+		fmt.Fprintln(w, "rsh: command timed out")
+	}
+}
+
+func (c *Client) readStream(stream pb.RemoteShell_SessionClient, stdout, stderr io.Writer) (*int, error) {
+	var sessionID string
 	for {
 		select {
 		case <-stream.Context().Done():
@@ -174,17 +455,51 @@ func (c *Client) readStream(stream pb.RemoteShell_SessionClient) (*int, error) {
 			}
 
 			if err != nil {
+				if sessionID != "" {
+					return nil, &DetachedError{SessionID: sessionID, Err: err}
+				}
 				return nil, err
 			}
 
+			if out.SessionId != "" {
+				sessionID = out.SessionId
+			}
+			if out.Notice != "" {
+				fmt.Fprintf(stderr, "\r\nrsh: %s\r\n", out.Notice)
+			}
+
 			// Exited = true 为命令已结束
 			if out.Exited {
+				printExitReason(stderr, out)
 				var exitCode int = int(out.ExitCode)
 				return &exitCode, nil
 			}
 
-			os.Stdout.Write(out.Stdout)
-			os.Stderr.Write(out.Stderr)
+			stdout.Write(out.Stdout)
+			stderr.Write(out.Stderr)
+		}
+	}
+}
+
+func (c *Client) sendStdin(stream pb.RemoteShell_SessionClient, r io.Reader) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			// 远端命令结束后 stream 关闭，Send 返回 io.EOF
+			if err := stream.Send(&pb.Input{Bytes: buf[:n]}); err != nil {
+				if err != io.EOF {
+					slog.Info("Error sending stdin:", slog.Any("err", err))
+				}
+				return
+			}
+		}
+		if err != nil {
+			if err != io.EOF {
+				slog.Info("Error reading stdin:", slog.Any("err", err))
+			}
+			stream.Send(&pb.Input{CloseStdin: true})
+			return
 		}
 	}
 }
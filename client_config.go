@@ -0,0 +1,204 @@
+package rsh
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ClientConfig is the client configuration file, by default ~/.config/rsh/config:
+//
+//	hosts:
+//	  "*":                  # defaults for every alias
+//	    ca: ca.pem
+//	  prod-db:
+//	    address: db1.example.com:22222
+//	    scheme: tls
+//	    cert: alice.pem
+//	    key: alice-key.pem
+//	    terminal: true
+//	    user: postgres
+//	  local:
+//	    address: unix:///run/rsh.sock
+//	  edge-1:               # agent behind a reverse tunnel server
+//	    jump: tunnel.example.com:22222
+type ClientConfig struct {
+	Hosts map[string]*HostConfig `yaml:"hosts"`
+
+	dir string // 配置文件所在目录，相对路径相对于该目录
+}
+
+// HostConfig configures the connection to one host alias.
+type HostConfig struct {
+	// Address 为 host[:port]、scheme://host[:port] 或 unix:///path/to/socket，
+	// 设置了 Jump 时为 agent 的 client-id，为空时使用别名
+	Address string `yaml:"address"`
+	// Scheme 为 tcp、tls 或 unix，与 ConnectionManager 相同，为空时取 Address 中的 scheme，
+	// 都未指定时设置了 CA 的使用 tls，否则使用 tcp
+	Scheme     string `yaml:"scheme"`
+	CA         string `yaml:"ca"`
+	Cert       string `yaml:"cert"`
+	Key        string `yaml:"key"`
+	ServerName string `yaml:"serverName"`
+	Token      string `yaml:"token"`
+	TokenFile  string `yaml:"tokenFile"` // 从文件读取 token，优先于 Token
+	Terminal   *bool  `yaml:"terminal"`  // 默认是否分配终端，类似 -t
+	Jump       string `yaml:"jump"`      // 经由跳板机 (开启了 jump 的反向隧道服务端) 连接，可以是别名或地址
+	User       string `yaml:"user"`      // 以该服务端本地用户运行命令，类似 -l
+	Profile    string `yaml:"profile"`   // 在服务端的沙箱 profile 中运行命令，类似 -profile
+}
+
+// DefaultClientConfigPath returns $RSH_CONFIG, or rsh/config in the user config directory.
+func DefaultClientConfigPath() string {
+	if path := os.Getenv("RSH_CONFIG"); path != "" {
+		return path
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "rsh", "config")
+}
+
+// LoadClientConfig reads a client configuration file.
+func LoadClientConfig(path string) (*ClientConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &ClientConfig{dir: filepath.Dir(path)}
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("parse client config %s: %v", path, err)
+	}
+	for name, h := range c.Hosts {
+		if h == nil {
+			return nil, fmt.Errorf("client config %s: host %q is empty", path, name)
+		}
+		switch h.Scheme {
+		case "", "tcp", "tls", "unix":
+		default:
+			return nil, fmt.Errorf("client config %s: host %q: unknown scheme %q", path, name, h.Scheme)
+		}
+	}
+	return c, nil
+}
+
+// Host returns the configuration of alias name merged over the "*" defaults, or false if name is not configured.
+// Relative file paths are resolved against the directory of the configuration file.
+func (c *ClientConfig) Host(name string) (*HostConfig, bool) {
+	if c == nil || name == "*" {
+		return nil, false
+	}
+	h, ok := c.Hosts[name]
+	if !ok {
+		return nil, false
+	}
+
+	merged := HostConfig{}
+	if defaults, ok := c.Hosts["*"]; ok {
+		merged = *defaults
+	}
+	merged.merge(h)
+	if merged.Address == "" {
+		merged.Address = name
+	}
+
+	for _, path := range []*string{&merged.CA, &merged.Cert, &merged.Key, &merged.TokenFile} {
+		*path = c.resolvePath(*path)
+	}
+	return &merged, true
+}
+
+func (h *HostConfig) merge(o *HostConfig) {
+	for _, f := range []struct{ dst, src *string }{
+		{&h.Address, &o.Address},
+		{&h.Scheme, &o.Scheme},
+		{&h.CA, &o.CA},
+		{&h.Cert, &o.Cert},
+		{&h.Key, &o.Key},
+		{&h.ServerName, &o.ServerName},
+		{&h.Token, &o.Token},
+		{&h.TokenFile, &o.TokenFile},
+		{&h.Jump, &o.Jump},
+		{&h.User, &o.User},
+		{&h.Profile, &o.Profile},
+	} {
+		if *f.src != "" {
+			*f.dst = *f.src
+		}
+	}
+	if o.Terminal != nil {
+		h.Terminal = o.Terminal
+	}
+}
+
+// resolvePath 展开 ~ 并把相对路径解析为相对于配置文件目录的路径
+func (c *ClientConfig) resolvePath(path string) string {
+	if path == "" {
+		return ""
+	}
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	if !filepath.IsAbs(path) {
+		return filepath.Join(c.dir, path)
+	}
+	return path
+}
+
+// Endpoint returns the scheme (tcp, tls or unix) and the address to connect to:
+// host:port, using defaultPort when the address has none, or the socket path for unix.
+func (h *HostConfig) Endpoint(defaultPort uint) (scheme, address string) {
+	scheme, address = h.Scheme, h.Address
+	if s, rest, ok := strings.Cut(address, "://"); ok {
+		if scheme == "" {
+			scheme = s
+		}
+		address = rest
+	}
+	switch scheme {
+	case "http":
+		scheme = "tcp"
+	case "https":
+		scheme = "tls"
+	case "":
+		scheme = "tcp"
+		if h.CA != "" {
+			scheme = "tls"
+		}
+	}
+
+	if scheme == "unix" {
+		return scheme, address
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(strings.Trim(address, "[]"), strconv.Itoa(int(defaultPort)))
+	}
+	return scheme, address
+}
+
+// Target returns the address in the scheme://host:port form understood by ConnectionManager.
+func (h *HostConfig) Target(defaultPort uint) string {
+	scheme, address := h.Endpoint(defaultPort)
+	return scheme + "://" + address
+}
+
+// ReadToken returns the token from TokenFile, or Token when no file is set.
+func (h *HostConfig) ReadToken() (string, error) {
+	if h.TokenFile == "" {
+		return h.Token, nil
+	}
+	data, err := os.ReadFile(h.TokenFile)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
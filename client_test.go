@@ -0,0 +1,159 @@
+package rsh
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nxsre/go-rsh/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// fakeSessionServer 的 Session 按 fn 响应，模拟服务端拒绝、连接提前结束或命令正常退出
+type fakeSessionServer struct {
+	pb.UnimplementedRemoteShellServer
+	fn func(stream pb.RemoteShell_SessionServer, in *pb.Input) error
+}
+
+func (s *fakeSessionServer) Session(stream pb.RemoteShell_SessionServer) error {
+	in, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	return s.fn(stream, in)
+}
+
+func TestExecContextResult(t *testing.T) {
+	tests := []struct {
+		name     string
+		fn       func(pb.RemoteShell_SessionServer, *pb.Input) error
+		wantCode codes.Code // 期望的错误，为 OK 时按 exited 检查
+		exited   bool       // 期望返回退出码 3 和输出
+	}{
+		{
+			name: "denied",
+			fn: func(pb.RemoteShell_SessionServer, *pb.Input) error {
+				return status.Error(codes.PermissionDenied, "denied by policy")
+			},
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name: "unavailable",
+			fn: func(pb.RemoteShell_SessionServer, *pb.Input) error {
+				return status.Error(codes.Unavailable, "dial failed")
+			},
+			wantCode: codes.Unavailable,
+		},
+		{
+			name: "closed before exit",
+			fn:   func(pb.RemoteShell_SessionServer, *pb.Input) error { return nil },
+		},
+		{
+			name: "exited",
+			fn: func(stream pb.RemoteShell_SessionServer, in *pb.Input) error {
+				// 与服务端相同: 合并输出时一次性返回，否则先发送输出
+				if in.CombinedOutput {
+					return stream.Send(&pb.Output{Exited: true, ExitCode: 3, CombinedOutput: []byte("out")})
+				}
+				if err := stream.Send(&pb.Output{Stdout: []byte("out")}); err != nil {
+					return err
+				}
+				return stream.Send(&pb.Output{Exited: true, ExitCode: 3})
+			},
+			exited: true,
+		},
+	}
+
+	for _, tt := range tests {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv := grpc.NewServer()
+		pb.RegisterRemoteShellServer(srv, &fakeSessionServer{fn: tt.fn})
+		go srv.Serve(lis)
+
+		for _, combined := range []bool{true, false} {
+			var stdout, stderr bytes.Buffer
+			exitCode, err := NewClientInsecure(lis.Addr().String()).ExecContext(context.Background(), &ExecOptions{
+				Command:        "true",
+				CombinedOutput: combined,
+				Stdout:         &stdout,
+				Stderr:         &stderr,
+			})
+
+			switch {
+			case tt.wantCode != codes.OK:
+				if exitCode != nil || status.Code(err) != tt.wantCode {
+					t.Errorf("%s, combined %v: got %v, %v, want %v", tt.name, combined, exitCode, err, tt.wantCode)
+				}
+			case !tt.exited:
+				// 没有退出码时不能当作成功，多主机模式据此报告失败
+				if exitCode != nil {
+					t.Errorf("%s, combined %v: got exit code %d, want none", tt.name, combined, *exitCode)
+				}
+				if combined && err == nil {
+					t.Errorf("%s, combined: got no error", tt.name)
+				}
+			default:
+				if err != nil || exitCode == nil || *exitCode != 3 || stdout.String() != "out" {
+					t.Errorf("%s, combined %v: got %v, %v, output %q, want exit code 3", tt.name, combined, exitCode, err, stdout.String())
+				}
+			}
+		}
+		srv.Stop()
+	}
+}
+
+func TestNewClientTokenPlaintext(t *testing.T) {
+	tokens := make(chan string, 3)
+	fake := &fakeSessionServer{fn: func(stream pb.RemoteShell_SessionServer, _ *pb.Input) error {
+		md, _ := metadata.FromIncomingContext(stream.Context())
+		tokens <- strings.Join(md.Get("authorization"), ",")
+		return stream.Send(&pb.Output{Exited: true})
+	}}
+	serve := func(network, address string) net.Listener {
+		lis, err := net.Listen(network, address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		srv := grpc.NewServer()
+		pb.RegisterRemoteShellServer(srv, fake)
+		go srv.Serve(lis)
+		t.Cleanup(srv.Stop)
+		return lis
+	}
+	tcp := serve("tcp", "127.0.0.1:0").Addr().String()
+	unix := "unix://" + serve("unix", filepath.Join(t.TempDir(), "rsh.sock")).Addr().String()
+
+	exec := func(c *Client) error {
+		_, err := c.ExecContext(context.Background(), &ExecOptions{Command: "true", CombinedOutput: true, Stdout: io.Discard})
+		return err
+	}
+
+	// 没有 TLS 时不向 tcp 地址发送 token
+	if err := exec(NewClientToken(tcp, nil, "secret")); err == nil {
+		t.Fatal("token sent to a tcp server without TLS")
+	}
+	select {
+	case got := <-tokens:
+		t.Fatalf("server received %q", got)
+	default:
+	}
+
+	for _, c := range []*Client{NewClientToken(unix, nil, "secret"), NewClientTokenInsecure(tcp, "secret")} {
+		if err := exec(c); err != nil {
+			t.Fatal(err)
+		}
+		if got := <-tokens; got != "Bearer secret" {
+			t.Fatalf("server received %q, want the bearer token", got)
+		}
+	}
+}
@@ -2,18 +2,40 @@ package main
 
 import (
 	"code.cloudfoundry.org/tlsconfig"
+	"errors"
 	"flag"
 	"github.com/nxsre/go-rsh"
+	"io/fs"
 	"log"
 	"os"
+	"strings"
 )
 
 var (
 	addr            = flag.String("a", "127.0.0.1:22222,https://127.0.0.1:42222", "comma separated server addresses")
+	port            = flag.Uint("p", 22222, "server port for -a aliases whose address has no port")
 	shell           = flag.String("s", os.Getenv("SHELL"), "default shell to use")
 	cacert          = flag.String("ca", "./certs/ca.pem", "ca certificate file")
 	cert            = flag.String("cert", "./certs/client.pem", "server certificate file")
 	key             = flag.String("key", "./certs/client-key.pem", "server key file")
+	policyFile      = flag.String("policy", "", "command authorization policy file (YAML or JSON), reloaded on SIGHUP")
+	auditLog        = flag.String("audit-log", "", "append a JSON audit record of every session to this file")
+	auditSyslog     = flag.Bool("audit-syslog", false, "send a JSON audit record of every session to syslog")
+	recordDir       = flag.String("record-dir", "", "record terminal sessions as asciicast v2 files in this directory")
+	recordInput     = flag.Bool("record-input", false, "also record terminal input (may capture passwords)")
+	forwardAllow    = flag.String("forward-allow", "", "comma separated destinations port forwarding may connect to: CIDR, IP or host pattern, optionally with :port (empty allows any)")
+	forwardDeny     = flag.String("forward-deny", "", "comma separated destinations port forwarding may not connect to, checked before -forward-allow")
+	userMapFile     = flag.String("user-map", "", "file of \"<identity> <user>[,<user>...]\" lines allowing clients to run commands as other local users (gsh -l)")
+	sandboxFile     = flag.String("sandbox", "", "YAML file of sandbox profiles (rootfs, namespaces, read-only binds) sessions may run in")
+	limitCPUTime    = flag.Duration("limit-cpu-time", 0, "kill a command process after it used this much CPU time (0 means no limit)")
+	limitCPUs       = flag.Float64("limit-cpus", 0, "CPUs a session may use, e.g. 0.5 (needs -cgroup-parent)")
+	limitMemory     = flag.String("limit-memory", "", "memory a session may use, e.g. 512M; enforced per process with RLIMIT_AS without -cgroup-parent")
+	limitPids       = flag.Int64("limit-pids", 0, "processes and threads a session may run (needs -cgroup-parent)")
+	limitNoFile     = flag.Uint64("limit-nofile", 0, "open files per command process")
+	limitWall       = flag.Duration("limit-wall-time", 0, "terminate sessions running longer than this, also caps the client timeout (0 means no limit)")
+	cgroupParent    = flag.String("cgroup-parent", "", "delegated cgroup v2 directory to create a cgroup per session in, e.g. /sys/fs/cgroup/rsh")
+	labels          = flag.String("labels", "", "comma separated key=value labels advertised to the server, e.g. env=prod,role=db")
+	configFile      = flag.String("F", rsh.DefaultClientConfigPath(), "client configuration file with host aliases usable in -a")
 	lastResortShell = "/bin/sh"
 )
 
@@ -29,8 +51,55 @@ func parseArgs() {
 	}
 }
 
+// resolveAliases 把 -a 中配置文件里的别名替换为 scheme://host:port，
+// 未在命令行指定 -ca、-cert、-key 时使用别名配置的证书，所有别名的证书需要相同。
+// 反向隧道只使用客户端证书认证，别名中的 token 被忽略；agent 直接连接服务端，不能使用设置了 jump 的别名
+func resolveAliases() {
+	explicit := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	cfg, err := rsh.LoadClientConfig(*configFile)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) && !explicit["F"] {
+			return
+		}
+		log.Fatal(err)
+	}
+
+	files := map[string]*string{"ca": cacert, "cert": cert, "key": key}
+	fromAlias := map[string]string{}
+
+	addrs := strings.Split(*addr, ",")
+	for i, a := range addrs {
+		hc, ok := cfg.Host(a)
+		if !ok {
+			continue
+		}
+		if hc.Jump != "" {
+			log.Fatalf("-a %s: alias %s sets jump, agents connect to the reverse server directly", *addr, a)
+		}
+		if hc.Token != "" || hc.TokenFile != "" {
+			log.Printf("-a %s: ignoring the token of alias %s, reverse tunnels authenticate with the client certificate", *addr, a)
+		}
+		addrs[i] = hc.Target(*port)
+
+		for name, v := range map[string]string{"ca": hc.CA, "cert": hc.Cert, "key": hc.Key} {
+			if v == "" || explicit[name] {
+				continue
+			}
+			if prev, ok := fromAlias[name]; ok && prev != v {
+				log.Fatalf("-a %s: aliases use different %s files, set -%s", *addr, name, name)
+			}
+			fromAlias[name] = v
+			*files[name] = v
+		}
+	}
+	*addr = strings.Join(addrs, ",")
+}
+
 func main() {
 	parseArgs()
+	resolveAliases()
 
 	tlscfg, err := tlsconfig.Build(
 		tlsconfig.WithIdentityFromFile(*cert, *key),
@@ -41,8 +110,92 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
-	server := rsh.NewReverseClient(*addr, *shell, tlscfg, nil)
+	var opts []rsh.ServerOption
+	if *policyFile != "" {
+		policy, err := rsh.LoadPolicy(*policyFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		policy.ReloadOnSIGHUP()
+		opts = append(opts, rsh.WithPolicy(policy))
+	}
+
+	if *auditLog != "" {
+		sink, err := rsh.NewJSONFileAuditSink(*auditLog)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, rsh.WithAuditSink(sink))
+	}
+	if *auditSyslog {
+		sink, err := rsh.NewSyslogAuditSink("")
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, rsh.WithAuditSink(sink))
+	}
+	if *recordDir != "" {
+		opts = append(opts, rsh.WithRecording(*recordDir, *recordInput))
+	}
+	if *forwardAllow != "" || *forwardDeny != "" {
+		allow, err := rsh.ParseDestinationRules(strings.Split(*forwardAllow, ","))
+		if err != nil {
+			log.Fatal(err)
+		}
+		deny, err := rsh.ParseDestinationRules(strings.Split(*forwardDeny, ","))
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, rsh.WithForwardDestinations(allow, deny))
+	}
+	if *userMapFile != "" {
+		m, err := rsh.LoadUserMap(*userMapFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, rsh.WithUserMap(m))
+	}
+	if *sandboxFile != "" {
+		cfg, err := rsh.LoadSandboxConfig(*sandboxFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, rsh.WithSandbox(cfg))
+	}
+	if limits, ok := resourceLimits(); ok {
+		opts = append(opts, rsh.WithResourceLimits(limits))
+	}
+
+	if *labels != "" {
+		l, err := rsh.ParseLabels(*labels)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, rsh.WithLabels(l))
+	}
+
+	server := rsh.NewReverseClient(*addr, *shell, tlscfg, nil, opts...)
 	if err := server.Serve(); err != nil {
 		log.Fatalf("Serve: %v", err)
 	}
 }
+
+// resourceLimits 返回 -limit-* 参数指定的资源限制，都未指定时返回 false
+func resourceLimits() (rsh.ResourceLimits, bool) {
+	limits := rsh.ResourceLimits{
+		CPUTime:      *limitCPUTime,
+		CPUQuota:     *limitCPUs,
+		Pids:         *limitPids,
+		OpenFiles:    *limitNoFile,
+		WallTime:     *limitWall,
+		CgroupParent: *cgroupParent,
+	}
+	if *limitMemory != "" {
+		n, err := rsh.ParseByteSize(*limitMemory)
+		if err != nil {
+			log.Fatalf("-limit-memory: %v", err)
+		}
+		limits.Memory = n
+	}
+	return limits, limits != rsh.ResourceLimits{CgroupParent: *cgroupParent}
+}
@@ -26,8 +26,34 @@ var (
 	cert         = flag.String("cert", "./certs/server.pem", "server certificate file")
 	key          = flag.String("key", "./certs/server-key.pem", "server key file")
 	allowClients = flag.String("allow-clients", "root", "allow clients to connect")
+	jump         = flag.Bool("jump", false, "let rsh clients with a verified certificate reach agents through this server (gsh -J)")
+	jumpPolicy   = flag.String("jump-policy", "", "policy file authorizing -jump access with the @jump pseudo-command, required by -jump, reloaded on SIGHUP")
+	httpTokens   = flag.String("http-tokens", "", "file of \"<token> <subject>\" lines accepted as bearer tokens by the HTTP API, besides verified client certificates")
+	webTermDir   = flag.String("webterm-assets", "", "directory with xterm.js, xterm.css, addon-attach.js and addon-fit.js for the web terminal page")
+	forwards     forwardFlag
+	socks        forwardFlag
 )
 
+// forwardFlag 收集多次指定的 agent-id:spec，如 -L agent-id:[bind_address:]port:host:hostport
+type forwardFlag []string
+
+func (f *forwardFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *forwardFlag) Set(v string) error {
+	if _, _, ok := strings.Cut(v, ":"); !ok {
+		return fmt.Errorf("expected agent-id:..., got %q", v)
+	}
+	*f = append(*f, v)
+	return nil
+}
+
+func init() {
+	flag.Var(&forwards, "L", "forward local [bind_address:]port to host:hostport reachable from the agent, as agent-id:[bind_address:]port:host:hostport (repeatable)")
+	flag.Var(&socks, "D", "run a SOCKS5 proxy that connects from the agent, as agent-id:[bind_address:]port (repeatable)")
+}
+
 func parseArgs() {
 	flag.Parse()
 
@@ -67,10 +93,55 @@ func main() {
 	router.NoMethod(rsh.HandleNotFound)
 
 	server := rsh.NewReverseServer(router, tlscfg, strings.Split(*allowClients, ","))
+	if *jump {
+		if *jumpPolicy == "" {
+			log.Fatal("-jump requires -jump-policy")
+		}
+		policy, err := rsh.LoadPolicy(*jumpPolicy)
+		if err != nil {
+			log.Fatal(err)
+		}
+		policy.ReloadOnSIGHUP()
+		server.EnableJump(policy)
+	}
+	if *httpTokens != "" {
+		tokens, err := rsh.LoadTokens(*httpTokens)
+		if err != nil {
+			log.Fatal(err)
+		}
+		server.SetHTTPTokens(tokens)
+	}
+	if *webTermDir != "" {
+		server.SetWebTerminalAssets(os.DirFS(*webTermDir))
+	}
 	server.RegisterHandlers()
 
 	router.GET("/get/:deviceId", NewWeb(server))
 
+	for _, v := range forwards {
+		clientID, spec, _ := strings.Cut(v, ":")
+		listen, target, err := rsh.ParseForwardSpec(spec)
+		if err != nil {
+			log.Fatal(err)
+		}
+		go func() {
+			if err := server.ForwardLocal(context.Background(), clientID, listen, target); err != nil {
+				log.Fatalf("forward -L %s: %v", v, err)
+			}
+		}()
+	}
+	for _, v := range socks {
+		clientID, listen, _ := strings.Cut(v, ":")
+		if !strings.Contains(listen, ":") {
+			listen = "127.0.0.1:" + listen
+		}
+		go func() {
+			if err := server.ServeSOCKS(context.Background(), clientID, listen); err != nil {
+				log.Fatalf("socks -D %s: %v", v, err)
+			}
+		}()
+	}
+
 	nl, err := net.Listen("tcp", fmt.Sprintf("%s:%d", *addr, *port))
 	if err != nil {
 		log.Fatalln(err)
@@ -87,7 +158,7 @@ func main() {
 
 func NewWeb(server *rsh.ReverseServer) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		slog.Info("deviceID:::", c.Param("deviceId"))
+		slog.Info("deviceID:::", slog.String("deviceId", c.Param("deviceId")))
 		channel := server.GetClient(c.Param("deviceId"))
 		if channel == nil {
 			slog.Info("channel not found")
@@ -110,11 +181,23 @@ func NewWeb(server *rsh.ReverseServer) gin.HandlerFunc {
 			opts.Args = args[1:]
 		}
 
+		// 默认 3 秒，指定 timeout 时由 agent 结束超时的命令，HTTP 请求多等待一个宽限期以拿到结果
+		ctxTimeout := 3 * time.Second
+		if timeout, ok := c.GetQuery("timeout"); ok {
+			d, err := time.ParseDuration(timeout)
+			if err != nil {
+				rsh.NewResult(c).ErrorCode(100, "解析错误", err)
+				return
+			}
+			opts.Timeout = d
+			ctxTimeout = d + 10*time.Second
+		}
+
 		// let's ask some stuff
 		client := pb.NewRemoteShellClient(channel)
 
 		// Contact the server and print out its response.
-		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		ctx, cancel := context.WithTimeout(c.Request.Context(), ctxTimeout)
 		defer cancel()
 
 		// 调用客户端的服务
@@ -125,13 +208,18 @@ func NewWeb(server *rsh.ReverseServer) gin.HandlerFunc {
 			return
 		}
 
-		slog.Info("ExecOpts", opts)
+		slog.Info("ExecOpts", slog.Any("opts", opts))
 
-		err = stream.Send(&pb.Input{
+		in := &pb.Input{
 			Start:   true,
 			Command: opts.Command,
 			Args:    opts.Args,
-		})
+		}
+		if opts.Timeout > 0 {
+			in.Timeout = opts.Timeout.String()
+		}
+
+		err = stream.Send(in)
 		if err != nil {
 			log.Printf("send cmd: %v", err)
 			return
@@ -142,7 +230,7 @@ func NewWeb(server *rsh.ReverseServer) gin.HandlerFunc {
 			sigc = make(chan os.Signal, 1)
 		)
 
-		// TODO: 需要终端的场景(比如 webterm)
+		// 需要终端的场景(比如 webterm) 使用 /agents/:id/terminal
 		if opts.Terminal {
 			go rsh.WriteStream(stream, inc, sigc)
 		}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"io/fs"
+	"log"
+	"net"
+	"strconv"
+
+	"github.com/nxsre/go-rsh"
+)
+
+var (
+	// clientConfig 为 -F 指定的配置文件，未找到默认配置文件时为 nil
+	clientConfig *rsh.ClientConfig
+	// explicitFlags 为命令行显式指定的参数，优先于配置文件
+	explicitFlags = map[string]bool{}
+)
+
+// loadClientConfig 读取 -F 指定的配置文件，未指定 -F 且默认配置文件不存在时忽略
+func loadClientConfig() {
+	path := *configFile
+	if path == "" {
+		return
+	}
+
+	cfg, err := rsh.LoadClientConfig(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) && !explicitFlags["F"] {
+			return
+		}
+		log.Fatal(err)
+	}
+	clientConfig = cfg
+}
+
+// markExplicitFlags 记录 fs 中显式指定的参数，rename 将子命令中的参数名映射回全局参数名
+func markExplicitFlags(fs *flag.FlagSet, rename map[string]string) {
+	fs.Visit(func(f *flag.Flag) {
+		name := f.Name
+		if n, ok := rename[name]; ok {
+			name = n
+		}
+		explicitFlags[name] = true
+	})
+}
+
+// connection 是连接一台主机的参数，由配置文件中的别名和命令行参数合并得到
+type connection struct {
+	scheme     string // tcp、tls 或 unix
+	address    string // host:port 或 unix socket 路径
+	host       string // 未指定 serverName 时用于校验服务端证书
+	ca         string
+	cert       string
+	key        string
+	serverName string
+	token      string
+	terminal   *bool
+	jump       string // 跳板机
+	target     string // 经由跳板机连接时 agent 的 client-id
+	user       string // 运行命令的远端用户
+	profile    string // 服务端的沙箱 profile
+}
+
+// resolveConnection 返回连接 host 的参数，host 为配置文件中的别名时使用别名的配置，命令行显式指定的参数优先
+func resolveConnection(host string, port uint) connection {
+	c := connection{
+		scheme:     "tcp",
+		address:    net.JoinHostPort(host, strconv.Itoa(int(port))),
+		host:       host,
+		target:     host,
+		ca:         *cacert,
+		cert:       *cert,
+		key:        *key,
+		serverName: *serverName,
+		token:      *token,
+		user:       *remoteUser,
+		profile:    *profile,
+	}
+
+	hc, ok := clientConfig.Host(host)
+	if ok {
+		c.scheme, c.address = hc.Endpoint(port)
+		if h, _, err := net.SplitHostPort(c.address); err == nil {
+			c.host = h
+		}
+
+		for _, f := range []struct {
+			name     string
+			dst, src *string
+		}{
+			{"ca", &c.ca, &hc.CA},
+			{"cert", &c.cert, &hc.Cert},
+			{"key", &c.key, &hc.Key},
+			{"server-name", &c.serverName, &hc.ServerName},
+		} {
+			if !explicitFlags[f.name] && *f.src != "" {
+				*f.dst = *f.src
+			}
+		}
+		if !explicitFlags["token"] {
+			t, err := hc.ReadToken()
+			if err != nil {
+				log.Fatalf("%s: %v", host, err)
+			}
+			if t != "" {
+				c.token = t
+			}
+		}
+		if !explicitFlags["l"] && hc.User != "" {
+			c.user = hc.User
+		}
+		if !explicitFlags["profile"] && hc.Profile != "" {
+			c.profile = hc.Profile
+		}
+		c.terminal = hc.Terminal
+		c.jump = hc.Jump
+		c.target = hc.Address
+	}
+
+	// 别名的 scheme 由配置决定，命令行指定 -ca 时使用 TLS
+	if c.scheme == "tcp" && c.ca != "" && (!ok || explicitFlags["ca"]) {
+		c.scheme = "tls"
+	}
+	if (c.cert == "") != (c.key == "") {
+		log.Fatalf("%s: cert and key must be used together", host)
+	}
+	return c
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/nxsre/go-rsh"
+	"golang.org/x/term"
+)
+
+// copyPath 是 cp 的参数，远端路径写作 [host]:path
+type copyPath struct {
+	host   string
+	path   string
+	remote bool
+}
+
+func parseCopyPath(arg string) copyPath {
+	i := strings.Index(arg, ":")
+	// 与 scp 相同，冒号前含有 / 的视为本地路径
+	if i < 0 || strings.Contains(arg[:i], "/") {
+		return copyPath{path: arg}
+	}
+
+	p := copyPath{host: arg[:i], path: arg[i+1:], remote: true}
+	if p.path == "" {
+		p.path = "."
+	}
+	return p
+}
+
+func (p copyPath) String() string {
+	if p.remote {
+		return p.host + ":" + p.path
+	}
+	return p.path
+}
+
+// runCopy 实现 gsh cp / gscp，复用客户端的连接参数
+func runCopy(argv []string) {
+	fs := flag.NewFlagSet("cp", flag.ExitOnError)
+
+	// 复用连接参数，与 scp 一致: -P 指定端口，-p 表示保留属性
+	for _, name := range connectionFlags {
+		f := flag.Lookup(name)
+		if name == "p" {
+			name = "P"
+		}
+		fs.Var(f.Value, name, f.Usage)
+	}
+
+	recursive := fs.Bool("r", false, "recursively copy entire directories")
+	preserve := fs.Bool("p", false, "preserve modification times and ownership")
+	quiet := fs.Bool("q", false, "disable the progress meter")
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s cp [options] source... target\n\nRemote paths are written as [host]:path.\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(argv)
+
+	if fs.NArg() < 2 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	var (
+		srcs []copyPath
+		dst  = parseCopyPath(fs.Arg(fs.NArg() - 1))
+		host = dst.host
+	)
+
+	for _, arg := range fs.Args()[:fs.NArg()-1] {
+		src := parseCopyPath(arg)
+		if src.remote == dst.remote {
+			log.Fatalf("cp %s %s: exactly one of source and target must be remote", src, dst)
+		}
+		if src.host != "" {
+			if host != "" && host != src.host {
+				log.Fatalf("cp: all remote paths must be on the same host")
+			}
+			host = src.host
+		}
+		srcs = append(srcs, src)
+	}
+
+	if host != "" {
+		*addr = host
+	}
+	markExplicitFlags(fs, map[string]string{"P": "p", "p": "preserve"})
+	loadClientConfig()
+	checkArgs()
+
+	client := newClient()
+
+	opts := &rsh.TransferOptions{
+		Recursive: *recursive,
+		Preserve:  *preserve,
+		User:      resolveConnection(*addr, *port).user,
+	}
+
+	var progress *progressBar
+	if !*quiet && term.IsTerminal(int(os.Stderr.Fd())) {
+		progress = newProgressBar(os.Stderr)
+		opts.Progress = progress.update
+	}
+
+	ctx := context.Background()
+	for _, src := range srcs {
+		var err error
+		if dst.remote {
+			err = client.Upload(ctx, src.path, dst.path, opts)
+		} else {
+			err = client.Download(ctx, src.path, dst.path, opts)
+		}
+
+		if progress != nil {
+			progress.finish()
+		}
+
+		if err != nil {
+			log.Fatalf("cp %s: %v", src, err)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/nxsre/go-rsh"
+)
+
+// listFlag 收集多次指定的参数
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(v string) error {
+	*l = append(*l, v)
+	return nil
+}
+
+// startForwards 在后台运行 -L、-R 指定的端口转发和 -D 指定的 SOCKS5 代理，出错时退出
+func startForwards(ctx context.Context, client *rsh.Client) {
+	for _, spec := range localForwards {
+		listen, target, err := rsh.ParseForwardSpec(spec)
+		if err != nil {
+			log.Fatal(err)
+		}
+		go func() {
+			if err := client.ForwardLocal(ctx, listen, target); err != nil {
+				log.Fatalf("forward -L %s: %v", spec, err)
+			}
+		}()
+	}
+
+	if *socksAddr != "" {
+		listen := *socksAddr
+		if !strings.Contains(listen, ":") {
+			listen = "127.0.0.1:" + listen
+		}
+		go func() {
+			if err := client.ServeSOCKS(ctx, listen); err != nil {
+				log.Fatalf("socks -D %s: %v", *socksAddr, err)
+			}
+		}()
+	}
+
+	for _, spec := range remoteForwards {
+		listen, target, err := rsh.ParseForwardSpec(spec)
+		if err != nil {
+			log.Fatal(err)
+		}
+		go func() {
+			if err := client.ForwardRemote(ctx, listen, target); err != nil {
+				log.Fatalf("forward -R %s: %v", spec, err)
+			}
+		}()
+	}
+}
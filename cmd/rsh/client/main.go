@@ -1,37 +1,99 @@
 package main
 
 import (
+	"code.cloudfoundry.org/tlsconfig"
+	"context"
+	"crypto/tls"
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/nxsre/go-rsh"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/term"
 )
 
 var (
 	port           = flag.Uint("p", 22222, "server port")
 	addr           = flag.String("a", "127.0.0.1", "server address")
+	cacert         = flag.String("ca", "", "ca certificate file for verifying the server, enables TLS")
+	cert           = flag.String("cert", "", "client certificate file")
+	key            = flag.String("key", "", "client key file")
+	serverName     = flag.String("server-name", "", "server name to verify in the server certificate (default: the -a address)")
+	token          = flag.String("token", os.Getenv("RSH_TOKEN"), "bearer token sent to the server, requires TLS (-ca) except over unix sockets")
+	insecureToken  = flag.Bool("insecure-token", false, "allow sending the bearer token in plaintext to a tcp server without TLS")
+	configFile     = flag.String("F", rsh.DefaultClientConfigPath(), "client configuration file with host aliases")
+	jumpHost       = flag.String("J", "", "reach the agent given as the first argument or -a through this reverse tunnel server")
+	remoteUser     = flag.String("l", "", "run the command as this user on the server (the server must map your identity to it)")
+	login          = flag.Bool("login", false, "run a login shell, or the command through the remote user's login shell")
+	profile        = flag.String("profile", "", "run the command in this sandbox profile configured on the server")
+	targetPid      = flag.Int("target-pid", 0, "run the command in the namespaces of this server process, like nsenter")
+	targetCgroup   = flag.String("target-cgroup", "", "run the command in the namespaces of the first process in this cgroup, e.g. system.slice/docker-<id>.scope")
+	targetNs       = flag.String("target-ns", "", "comma separated namespaces to enter with -target-pid or -target-cgroup: mnt, net, pid, uts, ipc (default all)")
 	terminal       = flag.Bool("t", false, "pseudo-terminal allocation")
 	remoteExitCode = flag.Bool("e", false, "use exit code of remote process")
+	noStdin        = flag.Bool("n", false, "do not forward stdin (redirect stdin from /dev/null)")
+	combined       = flag.Bool("combined", true, "without -t, return stdout and stderr combined after the command exits; -combined=false streams them separately (-hosts streams unless -combined is given)")
+	separateStderr = flag.Bool("stderr", false, "keep stderr separate from stdout in terminal mode")
+	timeout        = flag.Duration("timeout", 0, "terminate the remote command after this duration (0 means no timeout)")
+	dir            = flag.String("dir", "", "remote working directory")
+	clearEnv       = flag.Bool("clear-env", false, "do not inherit the server environment")
+	env            = envFlag{}
+	noCommand      = flag.Bool("N", false, "do not execute a remote command, only forward ports")
+	socksAddr      = flag.String("D", "", "run a local SOCKS5 proxy on [bind_address:]port that connects from the server")
+	hosts          = flag.String("hosts", "", "comma separated host[:port] list to run the command on in parallel instead of -a")
+	hostsFile      = flag.String("hosts-file", "", "file with one host[:port] per line to run the command on in parallel")
+	parallel       = flag.Int("parallel", 32, "maximum number of hosts to run on at the same time with -hosts")
+	outputMode     = flag.String("o", "inline", "output with -hosts: inline (lines prefixed with the host), group (per host as it finishes) or json")
+	failFast       = flag.Bool("fail-fast", false, "with -hosts, cancel the remaining hosts after the first failure")
+	localForwards  listFlag
+	remoteForwards listFlag
+
+	// 连接相关的参数和远端用户，cp 等子命令复用
+	connectionFlags = []string{"a", "p", "ca", "cert", "key", "server-name", "token", "insecure-token", "F", "J", "l"}
 
 	command string
 	args    []string
+
+	subcommands = map[string]bool{"cp": true, "replay": true, "attach": true, "sessions": true, "kill": true}
 )
 
-func parseArgs() {
-	flag.Parse()
+// envFlag 收集多次指定的 -env KEY=VALUE
+type envFlag map[string]string
 
-	if port == nil || *port == 0 {
-		log.Fatal("-p is required")
-	}
+func (e envFlag) String() string {
+	return fmt.Sprint(map[string]string(e))
+}
 
-	if *port > 65535 {
-		log.Fatal("Invalid port: ")
+func (e envFlag) Set(v string) error {
+	k, val, ok := strings.Cut(v, "=")
+	if !ok || k == "" {
+		return fmt.Errorf("expected KEY=VALUE, got %q", v)
 	}
+	e[k] = val
+	return nil
+}
 
-	if addr == nil || *addr == "" {
-		log.Fatal("-a is required")
+func init() {
+	flag.Var(env, "env", "set a remote environment variable KEY=VALUE (repeatable)")
+	flag.Var(&localForwards, "L", "forward local [bind_address:]port to host:hostport reachable from the server (repeatable)")
+	flag.Var(&remoteForwards, "R", "forward [bind_address:]port on the server to local host:hostport (repeatable)")
+}
+
+func parseArgs() {
+	flag.Parse()
+
+	// gsh -J reverse-server agent-id [options]: agent-id 之后的参数继续按选项解析
+	if *jumpHost != "" && flag.NArg() > 0 && !subcommands[flag.Arg(0)] {
+		*addr = flag.Arg(0)
+		flag.CommandLine.Parse(flag.Args()[1:])
 	}
+	markExplicitFlags(flag.CommandLine, nil)
+	loadClientConfig()
+	checkArgs()
 
 	// Parse remote command arguments
 	var argsAfterDash []string
@@ -51,25 +113,195 @@ func parseArgs() {
 	}
 }
 
+func checkArgs() {
+	if port == nil || *port == 0 {
+		log.Fatal("-p is required")
+	}
+
+	if *port > 65535 {
+		log.Fatal("Invalid port: ")
+	}
+
+	if addr == nil || *addr == "" {
+		log.Fatal("-a is required")
+	}
+
+	if (*cert == "") != (*key == "") {
+		log.Fatal("-cert and -key must be used together")
+	}
+}
+
+func newClient() *rsh.Client {
+	return newClientFor(*addr, *port)
+}
+
+// newClientFor 创建连接 host:port 的客户端，host 可以是配置文件中的别名。
+// 指定了跳板机 (-J 或别名的 jump) 时连接跳板机，host 为跳板机上 agent 的 client-id。
+func newClientFor(host string, port uint) *rsh.Client {
+	c := resolveConnection(host, port)
+	jump := c.jump
+	if *jumpHost != "" {
+		jump = *jumpHost
+	}
+	if jump == "" {
+		return connect(c)
+	}
+
+	j := resolveConnection(jump, port)
+	if j.jump != "" {
+		log.Fatalf("%s: jump host %s has its own jump host, which is not supported", host, jump)
+	}
+	client := connect(j)
+	client.SetJumpTarget(c.target)
+	return client
+}
+
+// connect 创建按 c 连接的客户端
+func connect(c connection) *rsh.Client {
+	server := c.address
+	if c.scheme == "unix" {
+		server = "unix://" + c.address
+	}
+
+	var tlscfg *tls.Config
+	if c.scheme == "tls" || (c.scheme == "unix" && c.ca != "") {
+		opts := []tlsconfig.TLSOption{tlsconfig.WithExternalServiceDefaults()}
+		if c.cert != "" {
+			opts = append(opts, tlsconfig.WithIdentityFromFile(c.cert, c.key))
+		}
+
+		// 未指定 CA 时使用系统的根证书
+		var authority []tlsconfig.ClientOption
+		if c.ca != "" {
+			authority = append(authority, tlsconfig.WithAuthorityFromFile(c.ca))
+		}
+		cfg, err := tlsconfig.Build(opts...).Client(authority...)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		cfg.ServerName = c.serverName
+		if cfg.ServerName == "" {
+			cfg.ServerName = c.host
+		}
+		tlscfg = cfg
+	}
+
+	switch {
+	case c.token != "" && tlscfg == nil && c.scheme == "tcp":
+		// -token 默认取自 $RSH_TOKEN，未使用 TLS 时不能在用户不知情的情况下明文发送
+		if !*insecureToken {
+			log.Fatalf("%s: refusing to send the bearer token without TLS, use -ca or pass -insecure-token", c.address)
+		}
+		return rsh.NewClientTokenInsecure(server, c.token)
+	case c.token != "":
+		return rsh.NewClientToken(server, tlscfg, c.token)
+	case tlscfg != nil:
+		return rsh.NewClientTLS(server, tlscfg)
+	default:
+		return rsh.NewClientInsecure(server)
+	}
+}
+
 func main() {
+	// 以 gscp 名称运行时等同于 gsh cp
+	if filepath.Base(os.Args[0]) == "gscp" {
+		runCopy(os.Args[1:])
+		return
+	}
+
 	parseArgs()
 
-	client := rsh.NewClientInsecure(fmt.Sprintf("%s:%d", *addr, *port))
+	switch flag.Arg(0) {
+	case "cp":
+		runCopy(flag.Args()[1:])
+		return
+	case "replay":
+		runReplay(flag.Args()[1:])
+		return
+	case "attach":
+		runAttach(flag.Args()[1:])
+		return
+	case "sessions":
+		runSessions(flag.Args()[1:])
+		return
+	case "kill":
+		runKill(flag.Args()[1:])
+		return
+	}
 
-	opts := &rsh.ExecOptions{
-		Terminal:       *terminal,
-		Command:        command,
-		Args:           args,
-		CombinedOutput: true,
+	if *hosts != "" || *hostsFile != "" {
+		os.Exit(runMulti())
 	}
 
-	exitCode, err := client.Exec(opts)
+	conn := resolveConnection(*addr, *port)
+	if conn.terminal != nil && !explicitFlags["t"] {
+		*terminal = *conn.terminal
+	}
+
+	client := newClient()
+
+	startForwards(context.Background(), client)
+	if *noCommand {
+		select {}
+	}
 
-	if err != nil {
-		log.Fatalf("Exec: %v", err)
+	opts := &rsh.ExecOptions{
+		Terminal:         *terminal,
+		Command:          command,
+		Args:             args,
+		CombinedOutput:   *combined && !*terminal,
+		SeparateStderr:   *separateStderr,
+		Timeout:          *timeout,
+		Env:              env,
+		Dir:              *dir,
+		ClearEnv:         *clearEnv,
+		User:             conn.user,
+		Login:            *login,
+		Profile:          conn.profile,
+		TargetPid:        *targetPid,
+		TargetCgroup:     *targetCgroup,
+		TargetNamespaces: targetNamespaces(),
+	}
+
+	// stdin 不是终端时(管道或重定向)转发给远端命令
+	if !*terminal && !*noStdin && !term.IsTerminal(int(os.Stdin.Fd())) {
+		opts.Stdin = os.Stdin
 	}
 
+	exitCode, err := client.Exec(opts)
+	exitOnError("Exec", err)
+
 	if exitCode != nil && *remoteExitCode {
 		os.Exit(*exitCode)
 	}
 }
+
+// exitOnError 在出错时退出，可分离会话断开时提示如何重新附加
+func exitOnError(op string, err error) {
+	if err == nil {
+		return
+	}
+
+	var detached *rsh.DetachedError
+	if errors.As(err, &detached) {
+		fmt.Fprintf(os.Stderr, "\r\nrsh: connection lost, session %s is still running; reattach with: %s attach %s\n",
+			detached.SessionID, filepath.Base(os.Args[0]), detached.SessionID)
+		os.Exit(255)
+	}
+	log.Fatalf("%s: %v", op, err)
+}
+
+// targetNamespaces 返回 -target-ns 指定的 namespace，未指定时为 nil，由服务端进入全部
+func targetNamespaces() []string {
+	if *targetNs == "" {
+		return nil
+	}
+	var namespaces []string
+	for _, ns := range strings.Split(*targetNs, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	return namespaces
+}
@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nxsre/go-rsh"
+)
+
+// hostResult 是一台主机的执行结果，-o json 时每台主机输出一行
+type hostResult struct {
+	Host     string `json:"host"`
+	ExitCode *int   `json:"exit_code"`
+	Error    string `json:"error,omitempty"`
+	Stdout   string `json:"stdout,omitempty"`
+	Stderr   string `json:"stderr,omitempty"`
+	Duration string `json:"duration"`
+	canceled bool
+}
+
+func (r *hostResult) failed() bool {
+	return r.Error != "" || r.ExitCode == nil || *r.ExitCode != 0
+}
+
+// hostOutput 决定多主机执行时如何输出
+type hostOutput interface {
+	// writers 返回第 i 台主机的 stdout 和 stderr
+	writers(i int, host string) (stdout, stderr io.Writer)
+	// done 在第 i 台主机执行结束后调用
+	done(i int, result *hostResult)
+}
+
+// runMulti 在 -hosts 和 -hosts-file 指定的主机上并行执行命令，返回汇总的退出码:
+// 全部成功为 0，有命令以非 0 退出为 1，有主机无法执行命令为 255
+func runMulti() int {
+	hostList, err := loadHosts(*hosts, *hostsFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(hostList) == 0 {
+		log.Fatal("no hosts given")
+	}
+	if *terminal || *noCommand || len(localForwards) > 0 || len(remoteForwards) > 0 || *socksAddr != "" {
+		log.Fatal("-hosts cannot be used with -t, -N, -L, -R or -D")
+	}
+	if *parallel < 1 {
+		log.Fatal("-parallel must be at least 1")
+	}
+
+	var out hostOutput
+	switch *outputMode {
+	case "inline":
+		out = &inlineOutput{}
+	case "group":
+		out = &groupOutput{}
+	case "json":
+		out = &jsonOutput{enc: json.NewEncoder(os.Stdout)}
+	default:
+		log.Fatalf("unknown output mode %q: expected inline, group or json", *outputMode)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	results := make([]*hostResult, len(hostList))
+	sem := make(chan struct{}, *parallel)
+	var wg sync.WaitGroup
+	for i, host := range hostList {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+			}
+
+			results[i] = runHost(ctx, i, host, out)
+			out.done(i, results[i])
+			if *failFast && results[i].failed() && !results[i].canceled {
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+
+	code, failed := 0, 0
+	for _, r := range results {
+		switch {
+		case r.canceled:
+			continue
+		case r.Error != "" || r.ExitCode == nil:
+			code = 255
+		case *r.ExitCode != 0 && code == 0:
+			code = 1
+		}
+		if r.failed() {
+			failed++
+		}
+	}
+	if *outputMode != "json" && (failed > 0 || ctx.Err() != nil) {
+		var canceled int
+		for _, r := range results {
+			if r.canceled {
+				canceled++
+			}
+		}
+		fmt.Fprintf(os.Stderr, "rsh: %d of %d hosts failed", failed, len(results))
+		if canceled > 0 {
+			fmt.Fprintf(os.Stderr, ", %d canceled", canceled)
+		}
+		fmt.Fprintln(os.Stderr)
+	}
+	return code
+}
+
+// runHost 在一台主机上执行命令
+func runHost(ctx context.Context, i int, host string, out hostOutput) *hostResult {
+	result := &hostResult{Host: host}
+	if ctx.Err() != nil {
+		result.Error, result.canceled = "canceled", true
+		return result
+	}
+
+	hostname, hostPort := splitHost(host, *port)
+	stdout, stderr := out.writers(i, host)
+
+	conn := resolveConnection(hostname, hostPort)
+	start := time.Now()
+	exitCode, err := newClientFor(hostname, hostPort).ExecContext(ctx, &rsh.ExecOptions{
+		Command:          command,
+		Args:             args,
+		CombinedOutput:   *combined && explicitFlags["combined"], // 默认流式输出，显式指定 -combined 时才合并
+		Timeout:          *timeout,
+		Env:              env,
+		Dir:              *dir,
+		ClearEnv:         *clearEnv,
+		Stdout:           stdout,
+		Stderr:           stderr,
+		User:             conn.user,
+		Login:            *login,
+		Profile:          conn.profile,
+		TargetPid:        *targetPid,
+		TargetCgroup:     *targetCgroup,
+		TargetNamespaces: targetNamespaces(),
+	})
+	result.Duration = time.Since(start).Round(time.Millisecond).String()
+	result.ExitCode = exitCode
+
+	switch {
+	case exitCode != nil:
+	case ctx.Err() != nil:
+		result.Error, result.canceled = "canceled", true
+	case err != nil:
+		result.Error = err.Error()
+	default:
+		result.Error = "connection closed without exit status"
+	}
+	return result
+}
+
+// loadHosts 合并 -hosts 和 -hosts-file 中的主机，文件中空行和 # 开头的行被忽略
+func loadHosts(list, file string) ([]string, error) {
+	var hosts []string
+	for _, h := range strings.Split(list, ",") {
+		if h = strings.TrimSpace(h); h != "" {
+			hosts = append(hosts, h)
+		}
+	}
+
+	if file != "" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			hosts = append(hosts, line)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return hosts, nil
+}
+
+// splitHost 拆分 host[:port]，未指定端口时使用 defaultPort
+func splitHost(host string, defaultPort uint) (string, uint) {
+	h, p, err := net.SplitHostPort(host)
+	if err != nil {
+		return strings.Trim(host, "[]"), defaultPort
+	}
+	n, err := strconv.ParseUint(p, 10, 16)
+	if err != nil {
+		return h, defaultPort
+	}
+	return h, uint(n)
+}
+
+// inlineOutput 输出带主机名前缀的行，多台主机的输出交错
+type inlineOutput struct {
+	mu   sync.Mutex
+	open map[int][2]*prefixWriter
+}
+
+func (o *inlineOutput) writers(i int, host string) (io.Writer, io.Writer) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.open == nil {
+		o.open = map[int][2]*prefixWriter{}
+	}
+	w := [2]*prefixWriter{
+		{mu: &o.mu, w: os.Stdout, prefix: host + ": "},
+		{mu: &o.mu, w: os.Stderr, prefix: host + ": "},
+	}
+	o.open[i] = w
+	return w[0], w[1]
+}
+
+func (o *inlineOutput) done(i int, result *hostResult) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if w, ok := o.open[i]; ok {
+		w[0].flush()
+		w[1].flush()
+		delete(o.open, i)
+	}
+	if result.Error != "" {
+		fmt.Fprintf(os.Stderr, "%s: rsh: %s\n", result.Host, result.Error)
+	} else if *result.ExitCode != 0 {
+		fmt.Fprintf(os.Stderr, "%s: rsh: exit status %d\n", result.Host, *result.ExitCode)
+	}
+}
+
+// prefixWriter 为每个完整的行加上前缀后写出，未结束的行在 flush 时写出
+type prefixWriter struct {
+	mu     *sync.Mutex
+	w      io.Writer
+	prefix string
+	buf    []byte
+}
+
+func (p *prefixWriter) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.buf = append(p.buf, b...)
+	for {
+		i := bytes.IndexByte(p.buf, '\n')
+		if i < 0 {
+			break
+		}
+		fmt.Fprintf(p.w, "%s%s", p.prefix, p.buf[:i+1])
+		p.buf = p.buf[i+1:]
+	}
+	return len(b), nil
+}
+
+// flush 写出未结束的行，调用方需要持有 mu
+func (p *prefixWriter) flush() {
+	if len(p.buf) > 0 {
+		fmt.Fprintf(p.w, "%s%s\n", p.prefix, p.buf)
+		p.buf = nil
+	}
+}
+
+// groupOutput 缓存每台主机的输出，主机执行结束后一起输出
+type groupOutput struct {
+	mu      sync.Mutex
+	buffers map[int][2]*bytes.Buffer
+}
+
+func (o *groupOutput) writers(i int, host string) (io.Writer, io.Writer) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.buffers == nil {
+		o.buffers = map[int][2]*bytes.Buffer{}
+	}
+	bufs := [2]*bytes.Buffer{{}, {}}
+	o.buffers[i] = bufs
+	return &syncWriter{mu: &o.mu, w: bufs[0]}, &syncWriter{mu: &o.mu, w: bufs[1]}
+}
+
+func (o *groupOutput) done(i int, result *hostResult) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	status := "ok"
+	switch {
+	case result.Error != "":
+		status = result.Error
+	case *result.ExitCode != 0:
+		status = fmt.Sprintf("exit status %d", *result.ExitCode)
+	}
+	if result.Duration != "" {
+		status += " (" + result.Duration + ")"
+	}
+	fmt.Fprintf(os.Stdout, "=== %s: %s\n", result.Host, status)
+
+	if bufs, ok := o.buffers[i]; ok {
+		os.Stdout.Write(bufs[0].Bytes())
+		os.Stderr.Write(bufs[1].Bytes())
+		delete(o.buffers, i)
+	}
+}
+
+// jsonOutput 在每台主机执行结束后输出一行 JSON
+type jsonOutput struct {
+	groupOutput
+	enc *json.Encoder
+}
+
+func (o *jsonOutput) done(i int, result *hostResult) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if bufs, ok := o.buffers[i]; ok {
+		result.Stdout, result.Stderr = bufs[0].String(), bufs[1].String()
+		delete(o.buffers, i)
+	}
+	o.enc.Encode(result)
+}
+
+// syncWriter 在持有 mu 时写入 w
+type syncWriter struct {
+	mu *sync.Mutex
+	w  io.Writer
+}
+
+func (s *syncWriter) Write(b []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(b)
+}
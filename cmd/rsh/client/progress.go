@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const progressBarWidth = 30
+
+// progressBar 在终端上显示当前文件的传输进度，类似 scp
+type progressBar struct {
+	w       io.Writer
+	path    string
+	start   time.Time
+	last    time.Time
+	written int64
+	size    int64
+}
+
+func newProgressBar(w io.Writer) *progressBar {
+	return &progressBar{w: w}
+}
+
+// update 用作 rsh.TransferOptions.Progress
+func (p *progressBar) update(path string, written, size int64) {
+	now := time.Now()
+	if path != p.path {
+		p.finish()
+		p.path = path
+		p.start = now
+	}
+
+	p.written, p.size = written, size
+
+	// 限制刷新频率，文件结束时总是刷新
+	if now.Sub(p.last) < 100*time.Millisecond && written < size {
+		return
+	}
+	p.last = now
+	p.render(now)
+}
+
+// finish 结束当前文件的进度行
+func (p *progressBar) finish() {
+	if p.path == "" {
+		return
+	}
+	p.render(time.Now())
+	fmt.Fprintln(p.w)
+	p.path = ""
+}
+
+func (p *progressBar) render(now time.Time) {
+	percent := int64(100)
+	if p.size > 0 {
+		percent = min(p.written*100/p.size, 100)
+	}
+
+	var rate int64
+	if elapsed := now.Sub(p.start).Seconds(); elapsed > 0 {
+		rate = int64(float64(p.written) / elapsed)
+	}
+
+	name := filepath.Base(p.path)
+	if len(name) > progressBarWidth {
+		name = name[:progressBarWidth-3] + "..."
+	}
+
+	filled := int(percent * progressBarWidth / 100)
+	fmt.Fprintf(p.w, "\r%-*s [%s%s] %3d%% %9s %9s/s",
+		progressBarWidth, name,
+		strings.Repeat("=", filled), strings.Repeat(" ", progressBarWidth-filled),
+		percent, formatBytes(p.written), formatBytes(rate),
+	)
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for v := n / unit; v >= unit; v /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/nxsre/go-rsh"
+)
+
+// runReplay 实现 gsh replay，在本地终端回放服务端录制的 asciicast 文件
+func runReplay(argv []string) {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	speed := fs.Float64("speed", 1, "playback speed multiplier")
+	maxIdle := fs.Duration("max-idle", 0, "limit pauses between events to this duration (0 means no limit)")
+
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s replay [options] file.cast\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(argv)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := rsh.PlayAsciicast(f, os.Stdout, *speed, *maxIdle); err != nil {
+		log.Fatalf("replay %s: %v", fs.Arg(0), err)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+// runAttach 实现 gsh attach，附加到服务端的可分离会话
+func runAttach(argv []string) {
+	fs := flag.NewFlagSet("attach", flag.ExitOnError)
+	readOnly := fs.Bool("r", false, "join read-only: watch the session without sending input")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [options] attach [-r] <session-id>\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(argv)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	exitCode, err := newClient().Attach(context.Background(), fs.Arg(0), *readOnly)
+	exitOnError("attach", err)
+
+	if exitCode != nil && *remoteExitCode {
+		os.Exit(*exitCode)
+	}
+}
+
+// runSessions 实现 gsh sessions，列出当前身份在服务端的可分离会话
+func runSessions(argv []string) {
+	sessions, err := newClient().ListSessions(context.Background())
+	if err != nil {
+		log.Fatalf("list sessions: %v", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTARTED\tSTATE\tCOMMAND")
+	for _, s := range sessions {
+		var state string
+		switch {
+		case s.Exited:
+			state = fmt.Sprintf("exited (%d)", s.ExitCode)
+		case s.Attached == 0:
+			state = "detached, expires " + time.Unix(0, s.ExpiresAt).Format(time.DateTime)
+		default:
+			var names []string
+			for _, p := range s.Participants {
+				if p.ReadOnly {
+					names = append(names, p.Name+" (read-only)")
+				} else {
+					names = append(names, p.Name)
+				}
+			}
+			state = "attached: " + strings.Join(names, ", ")
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", s.Id, time.Unix(0, s.StartTime).Format(time.DateTime), state,
+			strings.Join(append([]string{s.Command}, s.Args...), " "))
+	}
+	w.Flush()
+}
+
+// runKill 实现 gsh kill，结束服务端的可分离会话
+func runKill(argv []string) {
+	fs := flag.NewFlagSet("kill", flag.ExitOnError)
+	sig := fs.Int("signal", int(syscall.SIGHUP), "signal to send to the session's process group")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s [options] kill [-signal n] <session-id>\n\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(argv)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+
+	info, err := newClient().KillSession(context.Background(), fs.Arg(0), syscall.Signal(*sig))
+	if err != nil {
+		log.Fatalf("kill session: %v", err)
+	}
+	fmt.Printf("session %s exited with code %d\n", info.Id, info.ExitCode)
+}
@@ -1,11 +1,13 @@
 package main
 
 import (
+	"code.cloudfoundry.org/tlsconfig"
 	"flag"
 	"fmt"
 	"github.com/nxsre/go-rsh"
 	"log"
 	"os"
+	"strings"
 )
 
 var (
@@ -13,6 +15,31 @@ var (
 	addr  = flag.String("a", "127.0.0.1", "listen address")
 	shell = flag.String("s", os.Getenv("SHELL"), "default shell to use")
 
+	cacert       = flag.String("ca", "", "ca certificate file for verifying client certificates, enables TLS")
+	cert         = flag.String("cert", "", "server certificate file")
+	key          = flag.String("key", "", "server key file")
+	allowClients = flag.String("allow-clients", "", "comma separated client certificate CN/SANs allowed to connect, empty allows any")
+	token        = flag.String("token", os.Getenv("RSH_TOKEN"), "bearer token required from clients")
+	tokenFile    = flag.String("token-file", "", "file of \"<token> <subject>\" lines accepted as bearer tokens")
+	policyFile   = flag.String("policy", "", "command authorization policy file (YAML or JSON), reloaded on SIGHUP")
+	auditLog     = flag.String("audit-log", "", "append a JSON audit record of every session to this file")
+	auditSyslog  = flag.Bool("audit-syslog", false, "send a JSON audit record of every session to syslog")
+	recordDir    = flag.String("record-dir", "", "record terminal sessions as asciicast v2 files in this directory")
+	recordInput  = flag.Bool("record-input", false, "also record terminal input (may capture passwords)")
+	detachIdle   = flag.Duration("detach-timeout", 0, "keep terminal sessions running for this long after the client disconnects, reattach with \"gsh attach\" (0 disables)")
+	detachBuffer = flag.Int("detach-buffer", 256*1024, "bytes of recent output kept per detachable session for replay on attach")
+	forwardAllow = flag.String("forward-allow", "", "comma separated destinations port forwarding may connect to: CIDR, IP or host pattern, optionally with :port (empty allows any)")
+	forwardDeny  = flag.String("forward-deny", "", "comma separated destinations port forwarding may not connect to, checked before -forward-allow")
+	userMapFile  = flag.String("user-map", "", "file of \"<identity> <user>[,<user>...]\" lines allowing clients to run commands as other local users (gsh -l)")
+	sandboxFile  = flag.String("sandbox", "", "YAML file of sandbox profiles (rootfs, namespaces, read-only binds) sessions may run in")
+	limitCPUTime = flag.Duration("limit-cpu-time", 0, "kill a command process after it used this much CPU time (0 means no limit)")
+	limitCPUs    = flag.Float64("limit-cpus", 0, "CPUs a session may use, e.g. 0.5 (needs -cgroup-parent)")
+	limitMemory  = flag.String("limit-memory", "", "memory a session may use, e.g. 512M; enforced per process with RLIMIT_AS without -cgroup-parent")
+	limitPids    = flag.Int64("limit-pids", 0, "processes and threads a session may run (needs -cgroup-parent)")
+	limitNoFile  = flag.Uint64("limit-nofile", 0, "open files per command process")
+	limitWall    = flag.Duration("limit-wall-time", 0, "terminate sessions running longer than this, also caps the client timeout (0 means no limit)")
+	cgroupParent = flag.String("cgroup-parent", "", "delegated cgroup v2 directory to create a cgroup per session in, e.g. /sys/fs/cgroup/rsh")
+
 	lastResortShell = "/bin/sh"
 )
 
@@ -34,12 +61,111 @@ func parseArgs() {
 	if shell == nil || *shell == "" {
 		shell = &lastResortShell
 	}
+
+	if *cacert != "" && (*cert == "" || *key == "") {
+		log.Fatal("-cert and -key are required with -ca")
+	}
+}
+
+func serverOptions() []rsh.ServerOption {
+	var opts []rsh.ServerOption
+
+	if *cacert != "" {
+		tlscfg, err := tlsconfig.Build(
+			tlsconfig.WithIdentityFromFile(*cert, *key),
+			tlsconfig.WithInternalServiceDefaults(),
+		).Server(tlsconfig.WithClientAuthenticationFromFile(*cacert))
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var allow []string
+		if *allowClients != "" {
+			allow = strings.Split(*allowClients, ",")
+		}
+		opts = append(opts, rsh.WithTLS(tlscfg, allow))
+	}
+
+	tokens := map[string]string{}
+	if *tokenFile != "" {
+		t, err := rsh.LoadTokens(*tokenFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		tokens = t
+	}
+	if *token != "" {
+		tokens[*token] = "token"
+	}
+	if len(tokens) > 0 {
+		opts = append(opts, rsh.WithTokens(tokens))
+	}
+
+	if *policyFile != "" {
+		policy, err := rsh.LoadPolicy(*policyFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		policy.ReloadOnSIGHUP()
+		opts = append(opts, rsh.WithPolicy(policy))
+	}
+
+	if *auditLog != "" {
+		sink, err := rsh.NewJSONFileAuditSink(*auditLog)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, rsh.WithAuditSink(sink))
+	}
+	if *auditSyslog {
+		sink, err := rsh.NewSyslogAuditSink("")
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, rsh.WithAuditSink(sink))
+	}
+	if *recordDir != "" {
+		opts = append(opts, rsh.WithRecording(*recordDir, *recordInput))
+	}
+	if *forwardAllow != "" || *forwardDeny != "" {
+		allow, err := rsh.ParseDestinationRules(strings.Split(*forwardAllow, ","))
+		if err != nil {
+			log.Fatal(err)
+		}
+		deny, err := rsh.ParseDestinationRules(strings.Split(*forwardDeny, ","))
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, rsh.WithForwardDestinations(allow, deny))
+	}
+	if *userMapFile != "" {
+		m, err := rsh.LoadUserMap(*userMapFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, rsh.WithUserMap(m))
+	}
+	if *sandboxFile != "" {
+		cfg, err := rsh.LoadSandboxConfig(*sandboxFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		opts = append(opts, rsh.WithSandbox(cfg))
+	}
+	if limits, ok := resourceLimits(); ok {
+		opts = append(opts, rsh.WithResourceLimits(limits))
+	}
+	if *detachIdle > 0 {
+		opts = append(opts, rsh.WithDetachableSessions(*detachBuffer, *detachIdle))
+	}
+
+	return opts
 }
 
 func main() {
 	parseArgs()
 
-	server := rsh.NewServer(fmt.Sprintf("%s:%d", *addr, *port), *shell)
+	server := rsh.NewServer(fmt.Sprintf("%s:%d", *addr, *port), *shell, serverOptions()...)
 
 	log.Printf("Serving at %s:%d", *addr, *port)
 
@@ -47,3 +173,23 @@ func main() {
 		log.Fatalf("Serve: %v", err)
 	}
 }
+
+// resourceLimits 返回 -limit-* 参数指定的资源限制，都未指定时返回 false
+func resourceLimits() (rsh.ResourceLimits, bool) {
+	limits := rsh.ResourceLimits{
+		CPUTime:      *limitCPUTime,
+		CPUQuota:     *limitCPUs,
+		Pids:         *limitPids,
+		OpenFiles:    *limitNoFile,
+		WallTime:     *limitWall,
+		CgroupParent: *cgroupParent,
+	}
+	if *limitMemory != "" {
+		n, err := rsh.ParseByteSize(*limitMemory)
+		if err != nil {
+			log.Fatalf("-limit-memory: %v", err)
+		}
+		limits.Memory = n
+	}
+	return limits, limits != rsh.ResourceLimits{CgroupParent: *cgroupParent}
+}
@@ -0,0 +1,174 @@
+package rsh
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"path"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DestinationRule 匹配端口转发 (包括 SOCKS) 的目标地址。
+type DestinationRule struct {
+	network *net.IPNet // IP 或 CIDR
+	host    string     // 域名，支持 path.Match 通配符
+	port    string     // 为空时匹配所有端口
+}
+
+// ParseDestinationRules 解析目标规则，每条为 "CIDR[:port]"、"IP[:port]" 或 "域名[:port]"，
+// 域名支持通配符如 "*.example.com"，IPv6 带端口时写在方括号中如 "[fd00::/8]:443"。
+func ParseDestinationRules(rules []string) ([]DestinationRule, error) {
+	var parsed []DestinationRule
+	for _, rule := range rules {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+		r, err := parseDestinationRule(rule)
+		if err != nil {
+			return nil, fmt.Errorf("invalid destination %q: %v", rule, err)
+		}
+		parsed = append(parsed, r)
+	}
+	return parsed, nil
+}
+
+func parseDestinationRule(rule string) (DestinationRule, error) {
+	var r DestinationRule
+
+	host := rule
+	if strings.HasPrefix(rule, "[") {
+		i := strings.Index(rule, "]")
+		if i < 0 {
+			return r, fmt.Errorf("missing ]")
+		}
+		host = rule[1:i]
+		if rest := rule[i+1:]; rest != "" {
+			port, ok := strings.CutPrefix(rest, ":")
+			if !ok {
+				return r, fmt.Errorf("unexpected %q after ]", rest)
+			}
+			r.port = port
+		}
+	} else if i := strings.LastIndex(rule, ":"); i >= 0 && strings.Count(rule, ":") == 1 {
+		// 只有一个冒号时为端口，IPv6 地址不带端口时不加方括号
+		host, r.port = rule[:i], rule[i+1:]
+	}
+
+	if r.port == "*" {
+		r.port = ""
+	}
+
+	switch {
+	case strings.Contains(host, "/"):
+		_, network, err := net.ParseCIDR(host)
+		if err != nil {
+			return r, err
+		}
+		r.network = network
+	case net.ParseIP(host) != nil:
+		ip := net.ParseIP(host)
+		bits := 128
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 32
+		}
+		r.network = &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}
+	default:
+		if _, err := path.Match(host, ""); err != nil {
+			return r, err
+		}
+		r.host = strings.ToLower(host)
+	}
+	return r, nil
+}
+
+func (r *DestinationRule) match(host string, ip net.IP, port string) bool {
+	if r.port != "" && r.port != port {
+		return false
+	}
+	if r.network != nil {
+		return r.network.Contains(ip)
+	}
+	ok, _ := path.Match(r.host, strings.ToLower(host))
+	return ok
+}
+
+// WithForwardDestinations 限制端口转发可以连接的目标: 匹配 deny 的目标被拒绝，allow 不为空时目标必须匹配 allow。
+// 域名先在服务端解析，每个解析出的 IP 分别检查，只连接检查通过的 IP。
+func WithForwardDestinations(allow, deny []DestinationRule) ServerOption {
+	return func(o *serverOptions) {
+		o.forwardAllow = allow
+		o.forwardDeny = deny
+	}
+}
+
+func (o *serverOptions) destinationAllowed(host string, ip net.IP, port string) bool {
+	for i := range o.forwardDeny {
+		if o.forwardDeny[i].match(host, ip, port) {
+			return false
+		}
+	}
+	if len(o.forwardAllow) == 0 {
+		return true
+	}
+	for i := range o.forwardAllow {
+		if o.forwardAllow[i].match(host, ip, port) {
+			return true
+		}
+	}
+	return false
+}
+
+// dialForward 连接端口转发的目标 address
+func (s *rshServer) dialForward(ctx context.Context, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid address %q: %v", address, err)
+	}
+
+	dialer := &net.Dialer{Timeout: forwardDialTimeout}
+	if len(s.forwardAllow) == 0 && len(s.forwardDeny) == 0 {
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return nil, status.Errorf(codes.Unavailable, "dial %s: %v", address, err)
+		}
+		return conn, nil
+	}
+
+	denied := status.Errorf(codes.PermissionDenied, "destination %s is not allowed", address)
+	for i := range s.forwardDeny {
+		if r := &s.forwardDeny[i]; r.network == nil && r.match(host, nil, port) {
+			return nil, denied
+		}
+	}
+
+	// 解析后检查每个 IP 并直接连接该 IP，避免检查后解析结果改变
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, status.Errorf(codes.Unavailable, "resolve %s: %v", host, err)
+		}
+		for _, a := range addrs {
+			ips = append(ips, a.IP)
+		}
+	}
+
+	err = denied
+	for _, ip := range ips {
+		if !s.destinationAllowed(host, ip, port) {
+			continue
+		}
+		conn, dialErr := dialer.DialContext(ctx, "tcp", net.JoinHostPort(ip.String(), port))
+		if dialErr == nil {
+			return conn, nil
+		}
+		err = status.Errorf(codes.Unavailable, "dial %s: %v", address, dialErr)
+	}
+	return nil, err
+}
@@ -0,0 +1,93 @@
+package rsh
+
+import (
+	"net"
+	"testing"
+)
+
+func TestParseDestinationRules(t *testing.T) {
+	for _, rule := range []string{"[fd00::1", "[::1]x", "10.0.0.0/33", "[", "a[b"} {
+		if _, err := ParseDestinationRules([]string{rule}); err == nil {
+			t.Errorf("ParseDestinationRules(%q) succeeded, want error", rule)
+		}
+	}
+
+	rules, err := ParseDestinationRules([]string{" ", ""})
+	if err != nil || len(rules) != 0 {
+		t.Fatalf("empty rules: got %v, %v", rules, err)
+	}
+}
+
+func TestDestinationRuleMatch(t *testing.T) {
+	tests := []struct {
+		rule string
+		host string
+		ip   string
+		port string
+		want bool
+	}{
+		{"10.0.0.0/8", "", "10.1.2.3", "22", true},
+		{"10.0.0.0/8", "", "11.0.0.1", "22", false},
+		{"10.0.0.0/8", "", "::ffff:10.1.2.3", "22", true},
+		{"10.0.0.1:22", "", "10.0.0.1", "22", true},
+		{"10.0.0.1:22", "", "10.0.0.1", "23", false},
+		{"10.0.0.1:*", "", "10.0.0.1", "23", true},
+		{"fd00::1", "", "fd00::1", "443", true},
+		{"[fd00::/8]:443", "", "fd00::1", "443", true},
+		{"[fd00::/8]:443", "", "fd00::1", "80", false},
+		{"[fd00::1]", "", "fd00::2", "443", false},
+		{"*.example.com", "a.example.com", "192.0.2.1", "443", true},
+		{"*.example.com", "A.Example.COM", "192.0.2.1", "443", true},
+		{"*.example.com", "example.com", "192.0.2.1", "443", false},
+		{"*.example.com:443", "a.example.com", "192.0.2.1", "80", false},
+		{"example.com", "", "192.0.2.1", "443", false},
+		{"192.0.2.1", "192.0.2.1", "", "443", false},
+	}
+	for _, tt := range tests {
+		rules, err := ParseDestinationRules([]string{tt.rule})
+		if err != nil {
+			t.Fatalf("ParseDestinationRules(%q): %v", tt.rule, err)
+		}
+		if got := rules[0].match(tt.host, net.ParseIP(tt.ip), tt.port); got != tt.want {
+			t.Errorf("%q.match(%q, %q, %q) = %v, want %v", tt.rule, tt.host, tt.ip, tt.port, got, tt.want)
+		}
+	}
+}
+
+func TestDestinationAllowed(t *testing.T) {
+	parse := func(rules ...string) []DestinationRule {
+		t.Helper()
+		r, err := ParseDestinationRules(rules)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	o := &serverOptions{
+		forwardAllow: parse("10.0.0.0/8", "*.internal"),
+		forwardDeny:  parse("10.0.0.1", "10.0.0.0/8:22"),
+	}
+
+	tests := []struct {
+		host string
+		ip   string
+		port string
+		want bool
+	}{
+		{"", "10.0.0.2", "80", true},
+		{"", "10.0.0.1", "80", false},
+		{"", "10.0.0.2", "22", false},
+		{"", "192.0.2.1", "80", false},
+		{"db.internal", "192.0.2.1", "5432", true},
+		{"db.internal", "10.0.0.1", "5432", false},
+	}
+	for _, tt := range tests {
+		if got := o.destinationAllowed(tt.host, net.ParseIP(tt.ip), tt.port); got != tt.want {
+			t.Errorf("destinationAllowed(%q, %q, %q) = %v, want %v", tt.host, tt.ip, tt.port, got, tt.want)
+		}
+	}
+
+	if !(&serverOptions{}).destinationAllowed("example.com", net.ParseIP("192.0.2.1"), "80") {
+		t.Error("no rules: destination denied")
+	}
+}
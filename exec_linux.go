@@ -0,0 +1,55 @@
+//go:build linux
+
+package rsh
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// 服务端重新执行自身启动命令时的退出码，与 docker run 一致: 初始化失败、命令无法执行、命令不存在
+const (
+	execSetupExitCode    = 125
+	execFailedExitCode   = 126
+	execNotFoundExitCode = 127
+)
+
+// execWithLimits 设置 rlimits、切换到 cred 指定的用户后 exec path，成功时不返回。
+// 在 exec 之前设置 rlimit，命令和它创建的子进程从一开始就受到限制。
+// pdeathsig 时重新设置父进程退出时收到的 SIGKILL，切换用户会清除该设置。
+func execWithLimits(path string, args []string, cred *syscall.Credential, rlimits []rlimit, pdeathsig bool) error {
+	for _, r := range rlimits {
+		// 使用 syscall.Setrlimit，exec 时不再恢复 Go 运行时启动前的 RLIMIT_NOFILE
+		if err := syscall.Setrlimit(r.Resource, &syscall.Rlimit{Cur: r.Cur, Max: r.Max}); err != nil {
+			return fmt.Errorf("setrlimit %d: %v", r.Resource, err)
+		}
+	}
+
+	if cred != nil {
+		if !cred.NoSetGroups {
+			groups := make([]int, len(cred.Groups))
+			for i, g := range cred.Groups {
+				groups[i] = int(g)
+			}
+			if err := syscall.Setgroups(groups); err != nil {
+				return fmt.Errorf("setgroups: %v", err)
+			}
+		}
+		if err := syscall.Setgid(int(cred.Gid)); err != nil {
+			return fmt.Errorf("setgid: %v", err)
+		}
+		if err := syscall.Setuid(int(cred.Uid)); err != nil {
+			return fmt.Errorf("setuid: %v", err)
+		}
+	}
+
+	if pdeathsig {
+		if err := unix.Prctl(unix.PR_SET_PDEATHSIG, uintptr(unix.SIGKILL), 0, 0, 0); err != nil {
+			return fmt.Errorf("set parent death signal: %v", err)
+		}
+	}
+	return syscall.Exec(path, args, os.Environ())
+}
@@ -0,0 +1,331 @@
+package rsh
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/nxsre/go-rsh/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// 未指定并发数时同时执行命令的 agent 数
+const defaultFanOutConcurrency = 10
+
+// Selector matches agent labels. It is parsed from a comma separated list of
+// requirements, all of which must match: "key=value", "key!=value", "key" (present) or "!key" (absent).
+type Selector []selectorRequirement
+
+type selectorRequirement struct {
+	key, value string
+	op         string // "=", "!=", "exists", "!exists"
+}
+
+// ParseSelector parses a label selector such as "env=prod,role=db". An empty selector matches every agent.
+func ParseSelector(s string) (Selector, error) {
+	var sel Selector
+	for _, req := range strings.Split(s, ",") {
+		req = strings.TrimSpace(req)
+		if req == "" {
+			continue
+		}
+
+		var r selectorRequirement
+		switch {
+		case strings.Contains(req, "!="):
+			r.key, r.value, _ = strings.Cut(req, "!=")
+			r.op = "!="
+		case strings.Contains(req, "="):
+			r.key, r.value, _ = strings.Cut(req, "=")
+			r.value = strings.TrimPrefix(r.value, "=") // 同时支持 "=="
+			r.op = "="
+		case strings.HasPrefix(req, "!"):
+			r.key, r.op = req[1:], "!exists"
+		default:
+			r.key, r.op = req, "exists"
+		}
+		r.key, r.value = strings.TrimSpace(r.key), strings.TrimSpace(r.value)
+		if r.key == "" {
+			return nil, fmt.Errorf("invalid selector %q: missing label key", req)
+		}
+		sel = append(sel, r)
+	}
+	return sel, nil
+}
+
+// Matches reports whether labels satisfy every requirement of the selector.
+func (sel Selector) Matches(labels map[string]string) bool {
+	for _, r := range sel {
+		v, ok := labels[r.key]
+		switch r.op {
+		case "=":
+			if !ok || v != r.value {
+				return false
+			}
+		case "!=":
+			if ok && v == r.value {
+				return false
+			}
+		case "exists":
+			if !ok {
+				return false
+			}
+		case "!exists":
+			if ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// FanOutOptions are the options for ReverseServer.FanOutExec.
+type FanOutOptions struct {
+	Selector string // 为空时在所有 agent 上执行
+	// Concurrency 同时执行的 agent 数，不大于 0 时为 10
+	Concurrency int
+	Command     string
+	Args        []string
+	Env         map[string]string
+	Dir         string
+	// Timeout 为 0 时不限制，超时后 agent 结束命令，退出码为 124
+	Timeout time.Duration
+	// Output 接收各 agent 的输出，会被多个 goroutine 并发调用
+	Output func(FanOutOutput)
+	// Identity 为调用方身份，作为 rsh-identity 转发给 agent，由 agent 的策略授权
+	Identity string
+}
+
+// FanOutOutput is a chunk of output from one agent.
+type FanOutOutput struct {
+	ClientID string `json:"client_id"`
+	Stream   string `json:"stream"` // "stdout" 或 "stderr"
+	Data     string `json:"data"`
+}
+
+// FanOutResult is the outcome of a fan-out command on one agent.
+type FanOutResult struct {
+	ClientID string `json:"client_id"`
+	// ExitCode 为命令的退出码，命令未能执行完成时为 nil 并设置 Error
+	ExitCode *int   `json:"exit_code"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+// FanOutExec runs a command on every connected agent whose labels match opts.Selector,
+// at most opts.Concurrency at a time, and returns the results sorted by client-id.
+func (s *ReverseServer) FanOutExec(ctx context.Context, opts *FanOutOptions) ([]FanOutResult, error) {
+	sel, err := ParseSelector(opts.Selector)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Command == "" {
+		return nil, fmt.Errorf("no command given")
+	}
+
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultFanOutConcurrency
+	}
+
+	var agents []AgentInfo
+	for _, info := range s.ListClients() {
+		if sel.Matches(info.Labels) {
+			agents = append(agents, info)
+		}
+	}
+
+	results := make([]FanOutResult, len(agents))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, info := range agents {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				results[i] = FanOutResult{ClientID: info.ClientID, Error: ctx.Err().Error()}
+				return
+			}
+			results[i] = s.fanOutOne(ctx, info.ClientID, opts)
+		}()
+	}
+	wg.Wait()
+	return results, nil
+}
+
+// fanOutOne 在一个 agent 上执行命令
+func (s *ReverseServer) fanOutOne(ctx context.Context, clientID string, opts *FanOutOptions) FanOutResult {
+	start := time.Now()
+	result := FanOutResult{ClientID: clientID}
+
+	output := func(stream string) io.Writer {
+		return writerFunc(func(p []byte) (int, error) {
+			if opts.Output != nil {
+				opts.Output(FanOutOutput{ClientID: clientID, Stream: stream, Data: string(p)})
+			}
+			return len(p), nil
+		})
+	}
+
+	exitCode, err := func() (*int, error) {
+		cc, err := s.agentChannel(clientID)
+		if err != nil {
+			return nil, err
+		}
+		// agent 负责结束超时的命令，这里多等待一个宽限期以拿到退出码
+		if opts.Timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, opts.Timeout+10*time.Second)
+			defer cancel()
+		}
+		return execChannel(ctx, cc, opts.Identity, &pb.Input{
+			Start:   true,
+			Command: opts.Command,
+			Args:    opts.Args,
+			Env:     opts.Env,
+			Dir:     opts.Dir,
+			Timeout: durationString(opts.Timeout),
+		}, output("stdout"), output("stderr"))
+	}()
+
+	result.ExitCode = exitCode
+	if err != nil {
+		result.Error = err.Error()
+	}
+	result.Duration = time.Since(start).Round(time.Millisecond).String()
+	slog.Info("Fan-out exec finished", slog.String("client-id", clientID), slog.String("command", opts.Command), slog.String("duration", result.Duration))
+	return result
+}
+
+// execChannel 通过 cc 以 identity 的身份执行非终端命令，输出写到 stdout 和 stderr，返回退出码
+func execChannel(ctx context.Context, cc grpc.ClientConnInterface, identity string, in *pb.Input, stdout, stderr io.Writer) (*int, error) {
+	if identity != "" {
+		ctx = metadata.NewOutgoingContext(ctx, metadata.Pairs("rsh-identity", identity))
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := pb.NewRemoteShellClient(cc).Session(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("start session: %v", err)
+	}
+	if err := stream.Send(in); err != nil {
+		return nil, fmt.Errorf("send cmd: %v", err)
+	}
+
+	for {
+		out, err := stream.Recv()
+		if err == io.EOF {
+			return nil, fmt.Errorf("session closed without exit status")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(out.Stdout) > 0 {
+			stdout.Write(out.Stdout)
+		}
+		if len(out.Stderr) > 0 {
+			stderr.Write(out.Stderr)
+		}
+		if out.Exited {
+			exitCode := int(out.ExitCode)
+			return &exitCode, nil
+		}
+	}
+}
+
+// durationString 返回 Input.Timeout 使用的格式，0 时为空
+func durationString(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	return d.String()
+}
+
+// writerFunc 把函数适配为 io.Writer
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) {
+	return f(p)
+}
+
+// fanOutRequest 是 POST /exec 的请求体
+type fanOutRequest struct {
+	Selector    string            `json:"selector"`
+	Concurrency int               `json:"concurrency"`
+	Command     string            `json:"command"`
+	Args        []string          `json:"args"`
+	Env         map[string]string `json:"env"`
+	Dir         string            `json:"dir"`
+	Timeout     string            `json:"timeout"`
+}
+
+// handleFanOutExec 处理 POST /exec，以 NDJSON 流式返回各 agent 的输出，最后一行为 {"results": [...]}
+func (s *ReverseServer) handleFanOutExec(c *gin.Context) {
+	var req fanOutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		NewResult(c).ErrorCode(100, "解析错误", err.Error())
+		return
+	}
+	opts := &FanOutOptions{
+		Identity:    c.GetString(httpIdentityKey),
+		Selector:    req.Selector,
+		Concurrency: req.Concurrency,
+		Command:     req.Command,
+		Args:        req.Args,
+		Env:         req.Env,
+		Dir:         req.Dir,
+	}
+	if req.Timeout != "" {
+		d, err := time.ParseDuration(req.Timeout)
+		if err != nil {
+			NewResult(c).ErrorCode(100, "解析错误", err.Error())
+			return
+		}
+		opts.Timeout = d
+	}
+	if _, err := ParseSelector(req.Selector); err != nil {
+		NewResult(c).ErrorCode(100, "解析错误", err.Error())
+		return
+	}
+	if req.Command == "" {
+		NewResult(c).ErrorCode(100, "解析错误", "command is required")
+		return
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+
+	var mu sync.Mutex
+	enc := json.NewEncoder(c.Writer)
+	write := func(v any) {
+		mu.Lock()
+		defer mu.Unlock()
+		enc.Encode(v)
+		c.Writer.Flush()
+	}
+	opts.Output = func(out FanOutOutput) {
+		write(out)
+	}
+
+	results, err := s.FanOutExec(c.Request.Context(), opts)
+	if err != nil {
+		write(gin.H{"error": err.Error()})
+		return
+	}
+	if results == nil {
+		results = []FanOutResult{}
+	}
+	write(gin.H{"results": results})
+}
@@ -0,0 +1,41 @@
+package rsh
+
+import "testing"
+
+func TestParseSelector(t *testing.T) {
+	for _, s := range []string{"=prod", "!", "!=prod", " = "} {
+		if _, err := ParseSelector(s); err == nil {
+			t.Errorf("ParseSelector(%q) succeeded, want error", s)
+		}
+	}
+
+	labels := map[string]string{"env": "prod", "role": "db", "gpu": ""}
+	tests := []struct {
+		selector string
+		want     bool
+	}{
+		{"", true},
+		{"env=prod", true},
+		{"env==prod", true},
+		{" env = prod , role = db ", true},
+		{"env=prod,role=web", false},
+		{"env!=prod", false},
+		{"env!=dev", true},
+		{"zone!=a", true},
+		{"gpu", true},
+		{"gpu=", true},
+		{"!gpu", false},
+		{"zone", false},
+		{"!zone", true},
+		{"env=Prod", false},
+	}
+	for _, tt := range tests {
+		sel, err := ParseSelector(tt.selector)
+		if err != nil {
+			t.Fatalf("ParseSelector(%q): %v", tt.selector, err)
+		}
+		if got := sel.Matches(labels); got != tt.want {
+			t.Errorf("ParseSelector(%q).Matches(%v) = %v, want %v", tt.selector, labels, got, tt.want)
+		}
+	}
+}
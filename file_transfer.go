@@ -0,0 +1,481 @@
+package rsh
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/nxsre/go-rsh/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// 文件传输时每个 FileChunk 携带的最大数据量
+const fileChunkSize = 32 * 1024
+
+func (s *rshServer) Upload(stream pb.RemoteShell_UploadServer) error {
+	slog.Info("Opening upload")
+
+	// 写入文件的用户由第一个 Info 决定
+	chunk, err := stream.Recv()
+	if err == io.EOF {
+		return stream.SendAndClose(&pb.FileStatus{})
+	}
+	if err != nil {
+		return fmt.Errorf("recv: %v", err)
+	}
+	var name string
+	if chunk.Info != nil {
+		name = chunk.Info.User
+	}
+	a, err := s.resolveUser(stream.Context(), name)
+	if err != nil {
+		return err
+	}
+
+	return withFileUser(a, func() error {
+		r := &fileReceiver{}
+		for {
+			if chunk.Info != nil {
+				if chunk.Info.User != name {
+					r.abort()
+					return status.Errorf(codes.InvalidArgument, "file %s: user %q differs from %q", chunk.Info.Path, chunk.Info.User, name)
+				}
+				if !chunk.Info.Relative {
+					if err := s.authorize(stream.Context(), "@upload", []string{chunk.Info.Path}, false); err != nil {
+						r.abort()
+						return err
+					}
+				}
+			}
+
+			if err := r.receive(chunk); err != nil {
+				return err
+			}
+
+			chunk, err = stream.Recv()
+			if err == io.EOF {
+				if err := r.close(); err != nil {
+					return err
+				}
+				slog.Info("Upload closed", slog.Int64("files", r.files), slog.Int64("bytes", r.bytes))
+				return stream.SendAndClose(&pb.FileStatus{Files: r.files, Bytes: r.bytes})
+			}
+			if err != nil {
+				r.abort()
+				return fmt.Errorf("recv: %v", err)
+			}
+		}
+	})
+}
+
+func (s *rshServer) Download(req *pb.FileRequest, stream pb.RemoteShell_DownloadServer) error {
+	slog.Info("Opening download", slog.String("path", req.Path), slog.Bool("recursive", req.Recursive), slog.String("user", req.User))
+	if err := s.authorize(stream.Context(), "@download", []string{req.Path}, false); err != nil {
+		return err
+	}
+	a, err := s.resolveUser(stream.Context(), req.User)
+	if err != nil {
+		return err
+	}
+	return withFileUser(a, func() error {
+		return sendTree(stream.Send, req.Path, req.Path, &TransferOptions{Recursive: req.Recursive})
+	})
+}
+
+// UploadFile 上传本地文件 localPath 到远端 remotePath，cc 可以是 grpc 连接，也可以是 ReverseServer.GetClient 返回的反向隧道
+func UploadFile(ctx context.Context, cc grpc.ClientConnInterface, localPath, remotePath string, opts *TransferOptions) (*pb.FileStatus, error) {
+	if opts == nil {
+		opts = &TransferOptions{}
+	}
+
+	if _, err := os.Stat(localPath); err != nil {
+		return nil, err
+	}
+
+	stream, err := pb.NewRemoteShellClient(cc).Upload(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("start upload: %v", err)
+	}
+
+	if err := sendTree(stream.Send, localPath, remotePath, opts); err != nil {
+		stream.CloseSend()
+		return nil, err
+	}
+
+	return stream.CloseAndRecv()
+}
+
+// DownloadFile 下载远端文件 remotePath 到本地 localPath，localPath 为已存在的目录时保存到该目录下
+func DownloadFile(ctx context.Context, cc grpc.ClientConnInterface, remotePath, localPath string, opts *TransferOptions) error {
+	if opts == nil {
+		opts = &TransferOptions{}
+	}
+
+	stream, err := pb.NewRemoteShellClient(cc).Download(ctx, &pb.FileRequest{Path: remotePath, Recursive: opts.Recursive, User: opts.User})
+	if err != nil {
+		return fmt.Errorf("start download: %v", err)
+	}
+
+	r := &fileReceiver{progress: opts.Progress}
+	for {
+		chunk, err := stream.Recv()
+		if err == io.EOF {
+			return r.close()
+		}
+		if err != nil {
+			r.abort()
+			return err
+		}
+
+		if chunk.Info != nil {
+			// 顶层文件或目录保存到 localPath，子文件使用服务端发来的相对路径
+			if !chunk.Info.Relative {
+				chunk.Info.Path = localPath
+				chunk.Info.Name = filepath.Base(remotePath)
+			}
+			chunk.Info.Preserve = opts.Preserve
+		}
+		if err := r.receive(chunk); err != nil {
+			return err
+		}
+	}
+}
+
+// sendTree 发送 localPath，目录需要 opts.Recursive，顶层使用 remotePath，子文件使用相对路径
+func sendTree(send func(*pb.FileChunk) error, localPath, remotePath string, opts *TransferOptions) error {
+	fi, err := os.Stat(localPath)
+	if err != nil {
+		return err
+	}
+
+	if !fi.IsDir() {
+		return sendFile(send, localPath, newFileInfo(fi, remotePath, localPath, opts), opts)
+	}
+
+	if !opts.Recursive {
+		return fmt.Errorf("%s: is a directory", localPath)
+	}
+
+	return filepath.WalkDir(localPath, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// 跟随符号链接，指向目录的符号链接不递归，避免出现环
+		fi, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if d.Type()&fs.ModeSymlink != 0 && fi.IsDir() {
+			slog.Info("Skipping symlink to directory", slog.String("path", path))
+			return nil
+		}
+		if !fi.IsDir() && !fi.Mode().IsRegular() {
+			slog.Info("Skipping non-regular file", slog.String("path", path))
+			return nil
+		}
+
+		info := newFileInfo(fi, remotePath, localPath, opts)
+		if path != localPath {
+			rel, err := filepath.Rel(localPath, path)
+			if err != nil {
+				return err
+			}
+			info.Path = filepath.ToSlash(rel)
+			info.Name = ""
+			info.Relative = true
+		}
+
+		if fi.IsDir() {
+			return send(&pb.FileChunk{Info: info})
+		}
+		return sendFile(send, path, info, opts)
+	})
+}
+
+func newFileInfo(fi os.FileInfo, remotePath, localPath string, opts *TransferOptions) *pb.FileInfo {
+	info := &pb.FileInfo{
+		Path:     remotePath,
+		Name:     filepath.Base(localPath),
+		Mode:     uint32(fi.Mode().Perm()),
+		ModTime:  fi.ModTime().UnixNano(),
+		Size:     fi.Size(),
+		IsDir:    fi.IsDir(),
+		Preserve: opts.Preserve,
+		User:     opts.User,
+	}
+	if st, ok := fi.Sys().(*syscall.Stat_t); ok {
+		info.Uid = st.Uid
+		info.Gid = st.Gid
+	}
+	return info
+}
+
+// sendFile 按 FileChunk 协议发送单个文件: Info、Data、Checksum
+func sendFile(send func(*pb.FileChunk) error, localPath string, info *pb.FileInfo, opts *TransferOptions) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := send(&pb.FileChunk{Info: info}); err != nil {
+		return fmt.Errorf("send file info: %v", err)
+	}
+
+	var (
+		h       = sha256.New()
+		buf     = make([]byte, fileChunkSize)
+		written int64
+	)
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			h.Write(buf[:n])
+			if err := send(&pb.FileChunk{Data: buf[:n]}); err != nil {
+				return fmt.Errorf("send file data: %v", err)
+			}
+			written += int64(n)
+			if opts.Progress != nil {
+				opts.Progress(localPath, written, info.Size)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return send(&pb.FileChunk{Checksum: hex.EncodeToString(h.Sum(nil))})
+}
+
+// fileReceiver 按 FileChunk 协议接收文件和目录
+type fileReceiver struct {
+	w        *fileWriter
+	root     string         // 当前顶层目录的实际路径，Relative 路径基于它
+	dirs     []*receivedDir // 传输结束后再设置目录权限和修改时间，避免被后续写入覆盖
+	files    int64
+	bytes    int64
+	progress func(path string, written, size int64)
+}
+
+type receivedDir struct {
+	path string
+	info *pb.FileInfo
+}
+
+func (r *fileReceiver) receive(chunk *pb.FileChunk) error {
+	if chunk.Info != nil {
+		if r.w != nil {
+			path := r.w.path
+			r.abort()
+			return fmt.Errorf("file %s: new file started before checksum", path)
+		}
+
+		path, err := r.resolve(chunk.Info)
+		if err != nil {
+			return err
+		}
+
+		if chunk.Info.IsDir {
+			// 先保证属主可写，目录内的文件写完后再恢复原始权限
+			if err := os.Mkdir(path, os.FileMode(chunk.Info.Mode).Perm()|0700); err != nil && !os.IsExist(err) {
+				return err
+			}
+			if !chunk.Info.Relative {
+				r.root = path
+			}
+			r.dirs = append(r.dirs, &receivedDir{path: path, info: chunk.Info})
+			return nil
+		}
+
+		fw, err := newFileWriter(path, chunk.Info)
+		if err != nil {
+			return err
+		}
+		r.w = fw
+	}
+
+	if r.w == nil {
+		return fmt.Errorf("received file data before file info")
+	}
+
+	if len(chunk.Data) > 0 {
+		if _, err := r.w.Write(chunk.Data); err != nil {
+			r.abort()
+			return err
+		}
+		if r.progress != nil {
+			r.progress(r.w.path, r.w.n, r.w.info.Size)
+		}
+	}
+
+	if chunk.Checksum == "" {
+		return nil
+	}
+
+	fw := r.w
+	r.w = nil
+	if err := fw.commit(chunk.Checksum); err != nil {
+		return err
+	}
+	r.files++
+	r.bytes += fw.n
+	return nil
+}
+
+// resolve 返回 info 对应的本地路径，顶层目标为已存在的目录时保存到该目录下
+func (r *fileReceiver) resolve(info *pb.FileInfo) (string, error) {
+	if info.Relative {
+		rel := filepath.FromSlash(info.Path)
+		if r.root == "" || !filepath.IsLocal(rel) {
+			return "", fmt.Errorf("invalid relative path: %q", info.Path)
+		}
+		if err := checkNoSymlinks(r.root, filepath.Clean(rel)); err != nil {
+			return "", err
+		}
+		return filepath.Join(r.root, rel), nil
+	}
+
+	r.root = ""
+	path := info.Path
+	if fi, err := os.Stat(path); err == nil && fi.IsDir() && info.Name != "" {
+		path = filepath.Join(path, info.Name)
+	}
+	return path, nil
+}
+
+// checkNoSymlinks 检查 root 下 rel 经过的已存在路径都不是符号链接。
+// IsLocal 只检查路径本身，目标目录中已有的符号链接仍可能指向 root 之外
+func checkNoSymlinks(root, rel string) error {
+	path := root
+	for _, name := range strings.Split(rel, string(filepath.Separator)) {
+		path = filepath.Join(path, name)
+		fi, err := os.Lstat(path)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if fi.Mode()&fs.ModeSymlink != 0 {
+			return fmt.Errorf("%s: refusing to write through a symbolic link", path)
+		}
+	}
+	return nil
+}
+
+func (r *fileReceiver) abort() {
+	if r.w != nil {
+		r.w.abort()
+		r.w = nil
+	}
+}
+
+func (r *fileReceiver) close() error {
+	if r.w != nil {
+		path := r.w.path
+		r.abort()
+		return fmt.Errorf("file %s: unexpected end of stream", path)
+	}
+
+	for i := len(r.dirs) - 1; i >= 0; i-- {
+		d := r.dirs[i]
+		if err := os.Chmod(d.path, os.FileMode(d.info.Mode).Perm()); err != nil {
+			return err
+		}
+		if d.info.Preserve {
+			applyFileInfo(d.path, d.info)
+		}
+	}
+	return nil
+}
+
+// fileWriter 先写入同目录下的临时文件，校验通过后再 rename 到目标路径
+type fileWriter struct {
+	info *pb.FileInfo
+	path string
+	tmp  *os.File
+	hash hash.Hash
+	n    int64
+}
+
+func newFileWriter(path string, info *pb.FileInfo) (*fileWriter, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".rsh-*")
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileWriter{
+		info: info,
+		path: path,
+		tmp:  tmp,
+		hash: sha256.New(),
+	}, nil
+}
+
+// Write implements the io.Writer interface
+func (w *fileWriter) Write(p []byte) (int, error) {
+	n, err := w.tmp.Write(p)
+	w.hash.Write(p[:n])
+	w.n += int64(n)
+	return n, err
+}
+
+func (w *fileWriter) abort() {
+	w.tmp.Close()
+	os.Remove(w.tmp.Name())
+}
+
+func (w *fileWriter) commit(checksum string) error {
+	if sum := hex.EncodeToString(w.hash.Sum(nil)); sum != checksum {
+		w.abort()
+		return fmt.Errorf("file %s: checksum mismatch, expected %s, got %s", w.path, checksum, sum)
+	}
+
+	if err := w.tmp.Chmod(os.FileMode(w.info.Mode).Perm()); err != nil {
+		w.abort()
+		return err
+	}
+	if err := w.tmp.Close(); err != nil {
+		os.Remove(w.tmp.Name())
+		return err
+	}
+	if err := os.Rename(w.tmp.Name(), w.path); err != nil {
+		os.Remove(w.tmp.Name())
+		return err
+	}
+
+	if w.info.Preserve {
+		applyFileInfo(w.path, w.info)
+	}
+	return nil
+}
+
+// applyFileInfo 恢复修改时间，以 root 运行时同时恢复属主
+func applyFileInfo(path string, info *pb.FileInfo) {
+	mtime := time.Unix(0, info.ModTime)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		slog.Info("Error setting file times:", slog.String("path", path), slog.Any("err", err))
+	}
+	if os.Geteuid() != 0 {
+		return
+	}
+	if err := os.Lchown(path, int(info.Uid), int(info.Gid)); err != nil {
+		slog.Info("Error setting file owner:", slog.String("path", path), slog.Any("err", err))
+	}
+}
@@ -0,0 +1,51 @@
+//go:build linux
+
+package rsh
+
+import (
+	"fmt"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// withFileUser 以 a 的身份运行 fn 中的文件读写，a 为 nil 或与服务端进程的用户相同时直接运行。
+// 只修改一个锁定线程的附加组和 fsuid/fsgid，权限检查与该用户相同，其他 goroutine 不受影响
+func withFileUser(a *account, fn func() error) error {
+	if a == nil || a.credential() == nil {
+		return fn()
+	}
+
+	errC := make(chan error, 1)
+	go func() {
+		// 不解锁，goroutine 结束时该线程随之退出，不会被其他 goroutine 使用
+		runtime.LockOSThread()
+		if err := setFileUser(a); err != nil {
+			errC <- err
+			return
+		}
+		errC <- fn()
+	}()
+	return <-errC
+}
+
+// setFileUser 切换当前线程的附加组、fsgid 和 fsuid，setfsuid 不返回错误，需要再次读取确认
+func setFileUser(a *account) error {
+	groups := make([]int, len(a.groups))
+	for i, g := range a.groups {
+		groups[i] = int(g)
+	}
+	if err := unix.Setgroups(groups); err != nil {
+		return fmt.Errorf("user %s: setgroups: %v", a.name, err)
+	}
+
+	unix.Setfsgid(int(a.gid))
+	if gid, _ := unix.SetfsgidRetGid(-1); gid != int(a.gid) {
+		return fmt.Errorf("user %s: setfsgid %d failed", a.name, a.gid)
+	}
+	unix.Setfsuid(int(a.uid))
+	if uid, _ := unix.SetfsuidRetUid(-1); uid != int(a.uid) {
+		return fmt.Errorf("user %s: setfsuid %d failed", a.name, a.uid)
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package rsh
+
+import "fmt"
+
+// 以其他用户读写文件只支持 Linux
+func withFileUser(a *account, fn func() error) error {
+	if a != nil && a.credential() != nil {
+		return fmt.Errorf("transferring files as user %s is only supported on Linux", a.name)
+	}
+	return fn()
+}
@@ -0,0 +1,119 @@
+package rsh
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/nxsre/go-rsh/pb"
+)
+
+func checksum(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestFileReceiverNewFileBeforeChecksum(t *testing.T) {
+	dir := t.TempDir()
+	r := &fileReceiver{}
+
+	first := filepath.Join(dir, "a")
+	if err := r.receive(&pb.FileChunk{Info: &pb.FileInfo{Path: first, Mode: 0644}, Data: []byte("partial")}); err != nil {
+		t.Fatal(err)
+	}
+	err := r.receive(&pb.FileChunk{Info: &pb.FileInfo{Path: filepath.Join(dir, "b"), Mode: 0644}})
+	if err == nil || !strings.Contains(err.Error(), first) {
+		t.Fatalf("second Info before checksum: got %v, want an error naming %s", err, first)
+	}
+
+	// 未完成的临时文件被删除
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 0 {
+		t.Fatalf("leftover files: %v", entries)
+	}
+	if err := r.close(); err != nil {
+		t.Fatalf("close after abort: %v", err)
+	}
+}
+
+func TestFileReceiverRelativePath(t *testing.T) {
+	dir := t.TempDir()
+	top := filepath.Join(dir, "top")
+
+	tests := []struct {
+		path string
+		ok   bool
+	}{
+		{"sub.txt", true},
+		{"a/../b.txt", true},
+		{"../escape.txt", false},
+		{"a/../../escape.txt", false},
+		{"/etc/passwd", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			r := &fileReceiver{}
+			if err := r.receive(&pb.FileChunk{Info: &pb.FileInfo{Path: top, IsDir: true, Mode: 0755}}); err != nil {
+				t.Fatal(err)
+			}
+			err := r.receive(&pb.FileChunk{
+				Info:     &pb.FileInfo{Path: tt.path, Relative: true, Mode: 0644},
+				Data:     []byte("data"),
+				Checksum: checksum("data"),
+			})
+			if (err == nil) != tt.ok {
+				t.Fatalf("receive %q: got err %v, want ok=%v", tt.path, err, tt.ok)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "escape.txt")); err == nil {
+				t.Fatalf("%q was written outside the target directory", tt.path)
+			}
+		})
+	}
+
+	r := &fileReceiver{}
+	err := r.receive(&pb.FileChunk{Info: &pb.FileInfo{Path: "x", Relative: true}})
+	if err == nil {
+		t.Fatal("relative path without a top-level directory was accepted")
+	}
+}
+
+func TestFileReceiverSymlink(t *testing.T) {
+	dir := t.TempDir()
+	top := filepath.Join(dir, "top")
+	outside := filepath.Join(dir, "outside")
+	for _, d := range []string{top, outside} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(top, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "target.txt"), filepath.Join(top, "file.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"link/escape.txt", "link", "file.txt"} {
+		t.Run(path, func(t *testing.T) {
+			r := &fileReceiver{}
+			if err := r.receive(&pb.FileChunk{Info: &pb.FileInfo{Path: top, IsDir: true, Mode: 0755}}); err != nil {
+				t.Fatal(err)
+			}
+			err := r.receive(&pb.FileChunk{
+				Info:     &pb.FileInfo{Path: path, Relative: true, Mode: 0644},
+				Data:     []byte("data"),
+				Checksum: checksum("data"),
+			})
+			if err == nil {
+				t.Fatalf("receive %q through a symbolic link was accepted", path)
+			}
+			if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+				t.Fatalf("%q was written outside the target directory: %v", path, entries)
+			}
+		})
+	}
+}
@@ -0,0 +1,376 @@
+package rsh
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/nxsre/go-rsh/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// 连接转发目标的超时时间
+	forwardDialTimeout = 10 * time.Second
+	// ListenForward 接受的连接等待客户端认领的时间，超时后关闭
+	forwardClaimTimeout = 30 * time.Second
+)
+
+// ParseForwardSpec parses an ssh style forward "[bind_address:]port:host:hostport".
+// The bind address defaults to 127.0.0.1; IPv6 addresses are written in brackets.
+func ParseForwardSpec(spec string) (listenAddr, targetAddr string, err error) {
+	var fields []string
+	for rest := spec; rest != ""; {
+		var f string
+		if rest[0] == '[' {
+			i := strings.Index(rest, "]")
+			if i < 0 {
+				return "", "", fmt.Errorf("invalid forward %q: missing ]", spec)
+			}
+			f, rest = rest[1:i], rest[i+1:]
+		} else if i := strings.Index(rest, ":"); i >= 0 {
+			f, rest = rest[:i], rest[i:]
+		} else {
+			f, rest = rest, ""
+		}
+		fields = append(fields, f)
+		rest = strings.TrimPrefix(rest, ":")
+	}
+
+	switch len(fields) {
+	case 3:
+		fields = append([]string{"127.0.0.1"}, fields...)
+	case 4:
+	default:
+		return "", "", fmt.Errorf("invalid forward %q: expected [bind_address:]port:host:hostport", spec)
+	}
+	return net.JoinHostPort(fields[0], fields[1]), net.JoinHostPort(fields[2], fields[3]), nil
+}
+
+// forwardStream 是 Forward 客户端和服务端共有的方法
+type forwardStream interface {
+	Send(*pb.ForwardData) error
+	Recv() (*pb.ForwardData, error)
+}
+
+// pipeForward 在 stream 和 conn 之间双向拷贝数据，直到两个方向都结束。
+// conn 读到 EOF 时调用 closeSend，收到对方的 Close 或 EOF 时半关闭 conn。
+func pipeForward(stream forwardStream, conn net.Conn, closeSend func() error) error {
+	errc := make(chan error, 2)
+
+	go func() {
+		buf := make([]byte, 32*1024)
+		for {
+			n, err := conn.Read(buf)
+			if n > 0 {
+				if err := stream.Send(&pb.ForwardData{Data: buf[:n]}); err != nil {
+					errc <- err
+					return
+				}
+			}
+			if err == io.EOF {
+				errc <- closeSend()
+				return
+			}
+			if err != nil {
+				errc <- err
+				return
+			}
+		}
+	}()
+
+	go func() {
+		for {
+			in, err := stream.Recv()
+			if err == io.EOF || (err == nil && in.Close) {
+				closeWrite(conn)
+				errc <- nil
+				return
+			}
+			if err != nil {
+				errc <- err
+				return
+			}
+			if _, err := conn.Write(in.Data); err != nil {
+				errc <- err
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 2; i++ {
+		if err := <-errc; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// closeWrite 半关闭 conn，不支持半关闭时直接关闭
+func closeWrite(conn net.Conn) {
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+		return
+	}
+	conn.Close()
+}
+
+// pendingForwards 保存 ListenForward 接受、等待客户端认领的连接
+type pendingForwards struct {
+	mu    sync.Mutex
+	conns map[string]*pendingForward
+}
+
+type pendingForward struct {
+	conn     net.Conn
+	identity string // 只有发起 ListenForward 的身份可以认领
+	timer    *time.Timer
+}
+
+func newPendingForwards() *pendingForwards {
+	return &pendingForwards{conns: map[string]*pendingForward{}}
+}
+
+func (p *pendingForwards) add(id string, conn net.Conn, identity string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.conns[id] = &pendingForward{
+		conn:     conn,
+		identity: identity,
+		timer: time.AfterFunc(forwardClaimTimeout, func() {
+			if conn := p.claim(id, identity); conn != nil {
+				slog.Info("Forwarded connection not claimed", slog.String("conn", id))
+				conn.Close()
+			}
+		}),
+	}
+}
+
+func (p *pendingForwards) claim(id, identity string) net.Conn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	f, ok := p.conns[id]
+	if !ok || f.identity != identity {
+		return nil
+	}
+	delete(p.conns, id)
+	f.timer.Stop()
+	return f.conn
+}
+
+func (s *rshServer) Forward(stream pb.RemoteShell_ForwardServer) error {
+	ctx := stream.Context()
+
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+
+	var conn net.Conn
+	switch {
+	case first.ConnId != "":
+		conn = s.forwards.claim(first.ConnId, callerIdentity(ctx))
+		if conn == nil {
+			return status.Errorf(codes.NotFound, "forwarded connection %s not found", first.ConnId)
+		}
+		// 客户端无法连接本地目标时直接关闭
+		if first.Close {
+			conn.Close()
+			return nil
+		}
+
+	case first.Address != "":
+		if err := s.authorize(ctx, "@forward", []string{first.Address}, false); err != nil {
+			return err
+		}
+		conn, err = s.dialForward(ctx, first.Address)
+		if err != nil {
+			return err
+		}
+
+	default:
+		return status.Error(codes.InvalidArgument, "first message must set Address or ConnId")
+	}
+	defer conn.Close()
+
+	slog.Info("Forwarding", slog.String("identity", callerIdentity(ctx)), slog.String("remote", conn.RemoteAddr().String()))
+	if err := stream.Send(&pb.ForwardData{Address: conn.RemoteAddr().String()}); err != nil {
+		return err
+	}
+
+	if err := pipeForward(stream, conn, func() error {
+		return stream.Send(&pb.ForwardData{Close: true})
+	}); err != nil {
+		slog.Info("Forward error:", slog.Any("err", err))
+	}
+	return nil
+}
+
+func (s *rshServer) ListenForward(req *pb.ListenRequest, stream pb.RemoteShell_ListenForwardServer) error {
+	ctx := stream.Context()
+	identity := callerIdentity(ctx)
+
+	if err := s.authorize(ctx, "@listen", []string{req.Address}, false); err != nil {
+		return err
+	}
+
+	l, err := net.Listen("tcp", req.Address)
+	if err != nil {
+		return status.Errorf(codes.Unavailable, "listen %s: %v", req.Address, err)
+	}
+	defer l.Close()
+
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+
+	slog.Info("Remote forward listening", slog.String("identity", identity), slog.String("addr", l.Addr().String()))
+	if err := stream.Send(&pb.ForwardEvent{ListenAddr: l.Addr().String()}); err != nil {
+		return err
+	}
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		id := uuid.NewString()
+		s.forwards.add(id, conn, identity)
+		if err := stream.Send(&pb.ForwardEvent{ConnId: id, RemoteAddr: conn.RemoteAddr().String()}); err != nil {
+			return err
+		}
+	}
+}
+
+// ForwardLocal listens on listenAddr and forwards every connection through cc to remoteAddr
+// as seen from the server, like ssh -L. cc may be a reverse tunnel channel. It returns when ctx is done.
+func ForwardLocal(ctx context.Context, cc grpc.ClientConnInterface, listenAddr, remoteAddr string) error {
+	return forwardLocal(ctx, listenAddr, remoteAddr, func() (grpc.ClientConnInterface, error) {
+		return cc, nil
+	})
+}
+
+// forwardLocal 与 ForwardLocal 相同，每个连接通过 channel 获取转发使用的连接
+func forwardLocal(ctx context.Context, listenAddr, remoteAddr string, channel func() (grpc.ClientConnInterface, error)) error {
+	l, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+
+	slog.Info("Local forward listening", slog.String("addr", l.Addr().String()), slog.String("remote", remoteAddr))
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		go func() {
+			defer conn.Close()
+
+			cc, err := channel()
+			if err != nil {
+				slog.Info("Forward error:", slog.String("remote", remoteAddr), slog.Any("err", err))
+				return
+			}
+			if err := forwardConn(ctx, cc, conn, &pb.ForwardData{Address: remoteAddr}); err != nil {
+				slog.Info("Forward error:", slog.String("remote", remoteAddr), slog.Any("err", err))
+			}
+		}()
+	}
+}
+
+// ForwardRemote listens on remoteListenAddr on the server and forwards every connection
+// back to localAddr, like ssh -R. It returns when ctx is done or the server stops listening.
+func ForwardRemote(ctx context.Context, cc grpc.ClientConnInterface, remoteListenAddr, localAddr string) error {
+	stream, err := pb.NewRemoteShellClient(cc).ListenForward(ctx, &pb.ListenRequest{Address: remoteListenAddr})
+	if err != nil {
+		return err
+	}
+
+	for {
+		ev, err := stream.Recv()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		if ev.ListenAddr != "" {
+			slog.Info("Remote forward listening", slog.String("addr", ev.ListenAddr), slog.String("local", localAddr))
+			continue
+		}
+
+		go func() {
+			conn, err := net.DialTimeout("tcp", localAddr, forwardDialTimeout)
+			if err != nil {
+				slog.Info("Forward error:", slog.String("local", localAddr), slog.Any("err", err))
+				// 认领并关闭服务端的连接
+				if _, cancel, err := openForward(ctx, cc, &pb.ForwardData{ConnId: ev.ConnId, Close: true}); err == nil {
+					cancel()
+				}
+				return
+			}
+			defer conn.Close()
+
+			if err := forwardConn(ctx, cc, conn, &pb.ForwardData{ConnId: ev.ConnId}); err != nil {
+				slog.Info("Forward error:", slog.String("local", localAddr), slog.Any("err", err))
+			}
+		}()
+	}
+}
+
+// forwardConn 打开一个 Forward 流，first 指定转发目标，之后在流和 conn 之间转发数据
+func forwardConn(ctx context.Context, cc grpc.ClientConnInterface, conn net.Conn, first *pb.ForwardData) error {
+	stream, cancel, err := openForward(ctx, cc, first)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+
+	return pipeForward(stream, conn, stream.CloseSend)
+}
+
+// openForward 打开一个 Forward 流并等待服务端确认连接已建立，调用方使用完后需要调用 cancel
+func openForward(ctx context.Context, cc grpc.ClientConnInterface, first *pb.ForwardData) (pb.RemoteShell_ForwardClient, context.CancelFunc, error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	stream, err := pb.NewRemoteShellClient(cc).Forward(ctx)
+	if err != nil {
+		cancel()
+		return nil, nil, fmt.Errorf("open forward: %v", err)
+	}
+	if err := stream.Send(first); err != nil {
+		cancel()
+		return nil, nil, fmt.Errorf("send forward: %v", err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	return stream, cancel, nil
+}
@@ -0,0 +1,34 @@
+package rsh
+
+import "testing"
+
+func TestParseForwardSpec(t *testing.T) {
+	tests := []struct {
+		spec           string
+		listen, target string
+		wantErr        bool
+	}{
+		{spec: "8080:localhost:80", listen: "127.0.0.1:8080", target: "localhost:80"},
+		{spec: "0.0.0.0:8080:10.0.0.1:80", listen: "0.0.0.0:8080", target: "10.0.0.1:80"},
+		{spec: "[::1]:8080:[fd00::1]:80", listen: "[::1]:8080", target: "[fd00::1]:80"},
+		{spec: "8080:[fd00::1]:80", listen: "127.0.0.1:8080", target: "[fd00::1]:80"},
+		{spec: "", wantErr: true},
+		{spec: "8080", wantErr: true},
+		{spec: "8080:localhost", wantErr: true},
+		{spec: "a:b:c:d:e", wantErr: true},
+		{spec: "[::1:8080:localhost:80", wantErr: true},
+		{spec: "8080:fd00::1:80", wantErr: true},
+	}
+	for _, tt := range tests {
+		listen, target, err := ParseForwardSpec(tt.spec)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseForwardSpec(%q) = %q, %q, want error", tt.spec, listen, target)
+			}
+			continue
+		}
+		if err != nil || listen != tt.listen || target != tt.target {
+			t.Errorf("ParseForwardSpec(%q) = %q, %q, %v, want %q, %q", tt.spec, listen, target, err, tt.listen, tt.target)
+		}
+	}
+}
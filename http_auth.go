@@ -0,0 +1,60 @@
+package rsh
+
+import (
+	"encoding/base64"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// HTTP 接口认证得到的调用方身份在 gin.Context 中的 key
+const httpIdentityKey = "rsh-identity"
+
+// 浏览器不能为 WebSocket 设置 Authorization 头，token 以 "rsh.bearer.<base64url(token)>" 子协议发送
+const webSocketTokenPrefix = "rsh.bearer."
+
+// SetHTTPTokens lets callers of the HTTP API authenticate with "Authorization: Bearer <token>",
+// or with the "rsh.bearer.<base64url token>" subprotocol on WebSockets. tokens maps each token to its subject (see LoadTokens). Without tokens only client certificates
+// verified by the server's CA are accepted. Call it before RegisterHandlers.
+func (s *ReverseServer) SetHTTPTokens(tokens map[string]string) {
+	s.httpTokens = tokens
+}
+
+// httpIdentity 返回 HTTP 请求经过校验的客户端证书 CN 或 bearer token 的 subject
+func (s *ReverseServer) httpIdentity(r *http.Request) (string, bool) {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+		return r.TLS.VerifiedChains[0][0].Subject.CommonName, true
+	}
+	if s.httpTokens == nil {
+		return "", false
+	}
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return matchToken(s.httpTokens, token)
+	}
+	for _, p := range websocket.Subprotocols(r) {
+		if enc, ok := strings.CutPrefix(p, webSocketTokenPrefix); ok {
+			token, err := base64.RawURLEncoding.DecodeString(enc)
+			if err != nil {
+				return "", false
+			}
+			return matchToken(s.httpTokens, string(token))
+		}
+	}
+	return "", false
+}
+
+// requireHTTPIdentity 拒绝未认证的 HTTP 请求，认证得到的身份保存在 gin.Context 中
+func (s *ReverseServer) requireHTTPIdentity(c *gin.Context) {
+	identity, ok := s.httpIdentity(c.Request)
+	if !ok {
+		slog.Warn("Unauthenticated HTTP request", slog.String("path", c.Request.URL.Path), slog.String("remote", c.Request.RemoteAddr))
+		c.Header("WWW-Authenticate", "Bearer")
+		NewResult(c).ErrorCode(http.StatusUnauthorized, "未认证", "a verified client certificate or bearer token is required")
+		return
+	}
+	c.Set(httpIdentityKey, identity)
+	c.Next()
+}
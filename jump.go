@@ -0,0 +1,154 @@
+package rsh
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"strings"
+
+	"github.com/nxsre/go-rsh/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// 经由跳板机调用时指定目标 agent 的 metadata
+const jumpTargetKey = "rsh-target"
+
+// EnableJump lets rsh clients reach connected agents through this server, like ssh -J.
+// Callers must present a client certificate verified by the server's CA; its CN is forwarded
+// to the agent as the caller identity. Agents share that CA, so each call is authorized with policy,
+// using the "@jump" pseudo-command and the agent client-id as ClientID and argument.
+// A nil policy denies every call. Call it before RegisterHandlers.
+func (s *ReverseServer) EnableJump(policy *PolicyEngine) {
+	s.jump = true
+	s.jumpPolicy = policy
+}
+
+// jumpIdentity 返回跳板机调用方经过校验的客户端证书 CN
+func jumpIdentity(ctx context.Context) (string, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "", status.Error(codes.Unauthenticated, "no peer")
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return "", status.Error(codes.Unauthenticated, "jump requires a verified client certificate")
+	}
+	return tlsInfo.State.VerifiedChains[0][0].Subject.CommonName, nil
+}
+
+// authorizeJump 按策略检查 identity 是否可以经由跳板机访问 agent clientID，没有策略时拒绝
+func (s *ReverseServer) authorizeJump(identity, clientID, method string) error {
+	if s.jumpPolicy == nil {
+		slog.Warn("Jump denied, no jump policy", slog.String("identity", identity), slog.String("client-id", clientID), slog.String("method", method))
+		return status.Errorf(codes.PermissionDenied, "jump to %s: no jump policy configured", clientID)
+	}
+
+	req := &PolicyRequest{
+		Identity: identity,
+		ClientID: clientID,
+		Command:  "@jump",
+		Args:     []string{clientID},
+	}
+	d := s.jumpPolicy.Evaluate(req)
+
+	attrs := []any{
+		slog.String("identity", identity),
+		slog.String("client-id", clientID),
+		slog.String("method", method),
+		slog.String("rule", d.Rule),
+	}
+	switch d.Action {
+	case PolicyDeny:
+		slog.Warn("Policy denied jump", attrs...)
+		return status.Errorf(codes.PermissionDenied, "jump to %s: denied by policy", clientID)
+	case PolicyAudit:
+		slog.Warn("Policy audit", attrs...)
+	}
+	// 跳板机不能把调用放进沙箱，要求沙箱 profile 的规则不允许经由跳板机访问
+	if d.Profile != "" {
+		slog.Warn("Policy denied jump, sandbox profile cannot be applied", append(attrs, slog.String("profile", d.Profile))...)
+		return status.Errorf(codes.PermissionDenied, "jump to %s: denied by policy, rule %s requires sandbox profile %s", clientID, d.Rule, d.Profile)
+	}
+	return nil
+}
+
+// proxyRemoteShell 把 RemoteShell 调用转发到 rsh-target 指定的 agent。
+// 消息以 emptypb.Empty 接收，所有字段作为未知字段保留，原样发送给 agent，不需要解析具体的消息类型。
+func (s *ReverseServer) proxyRemoteShell(_ any, stream grpc.ServerStream) error {
+	ctx := stream.Context()
+
+	method, ok := grpc.MethodFromServerStream(stream)
+	if !ok || !strings.HasPrefix(method, "/"+pb.RemoteShell_ServiceDesc.ServiceName+"/") {
+		return status.Errorf(codes.Unimplemented, "unknown method %s", method)
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	var clientID string
+	if v := md.Get(jumpTargetKey); len(v) > 0 {
+		clientID = v[0]
+	}
+	if clientID == "" {
+		return status.Errorf(codes.InvalidArgument, "missing %s metadata", jumpTargetKey)
+	}
+
+	identity, err := jumpIdentity(ctx)
+	if err != nil {
+		return err
+	}
+	if err := s.authorizeJump(identity, clientID, method); err != nil {
+		return err
+	}
+
+	channel := s.GetClient(clientID)
+	if channel == nil {
+		return status.Errorf(codes.NotFound, "agent %s is not connected", clientID)
+	}
+
+	// 只转发经过校验的身份，不转发调用方的其他 metadata
+	ctx, cancel := context.WithCancel(metadata.NewOutgoingContext(ctx, metadata.Pairs("rsh-identity", identity)))
+	defer cancel()
+
+	slog.Info("Jump", slog.String("identity", identity), slog.String("client-id", clientID), slog.String("method", method))
+	upstream, err := channel.NewStream(ctx, &grpc.StreamDesc{ServerStreams: true, ClientStreams: true}, method)
+	if err != nil {
+		return err
+	}
+
+	// 客户端 -> agent
+	go func() {
+		for {
+			m := &emptypb.Empty{}
+			if err := stream.RecvMsg(m); err != nil {
+				if err == io.EOF {
+					upstream.CloseSend()
+				} else {
+					cancel()
+				}
+				return
+			}
+			if err := upstream.SendMsg(m); err != nil {
+				return
+			}
+		}
+	}()
+
+	// agent -> 客户端，agent 返回的错误原样返回给客户端
+	for {
+		m := &emptypb.Empty{}
+		if err := upstream.RecvMsg(m); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if err := stream.SendMsg(m); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package rsh
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Output.LimitExceeded 的取值
+const (
+	LimitMemory   = "memory"
+	LimitCPU      = "cpu"
+	LimitWallTime = "wall-time"
+)
+
+// ResourceLimits 限制每个会话启动的命令可以使用的资源，零值表示不限制。
+// CPUQuota、Memory 和 Pids 作用于整个会话，需要 cgroup v2 (CgroupParent)；
+// cgroup 不可用时 Memory 退化为每个进程的 RLIMIT_AS，CPUQuota 和 Pids 不生效。
+type ResourceLimits struct {
+	CPUTime   time.Duration // 每个进程的 CPU 时间 (RLIMIT_CPU)，超过后进程被终止
+	CPUQuota  float64       // 可以使用的 CPU 核数，如 0.5 (cpu.max)
+	Memory    int64         // 内存字节数 (memory.max)，超过后会话中的进程被 OOM 终止
+	Pids      int64         // 进程和线程数 (pids.max)
+	OpenFiles uint64        // 每个进程可以打开的文件数 (RLIMIT_NOFILE)
+	WallTime  time.Duration // 最长运行时间，Input.Timeout 未指定或更长时使用该值
+	// CgroupParent 为委派给服务端的 cgroup v2 目录，如 /sys/fs/cgroup/rsh，每个会话在其中创建临时的子 cgroup。
+	// 为空或不可用时只使用 rlimit。
+	CgroupParent string
+}
+
+// WithResourceLimits 限制每个会话启动的命令可以使用的资源，因超过限制被终止时 Output.LimitExceeded 为对应的限制。
+func WithResourceLimits(limits ResourceLimits) ServerOption {
+	return func(o *serverOptions) {
+		o.limits = &limits
+	}
+}
+
+// wallTimeout 返回会话实际的超时时间，以及是否由服务端的 WallTime 决定
+func (l *ResourceLimits) wallTimeout(timeout time.Duration) (time.Duration, bool) {
+	if l == nil || l.WallTime <= 0 || (timeout > 0 && timeout <= l.WallTime) {
+		return timeout, false
+	}
+	return l.WallTime, true
+}
+
+// ParseByteSize 解析 "512M"、"2G"、"1048576" 等字节数，单位为 1024 的幂。
+func ParseByteSize(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	units := []struct {
+		suffix string
+		shift  uint
+	}{{"K", 10}, {"M", 20}, {"G", 30}, {"T", 40}}
+
+	upper := strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(s), "B"), "I")
+	for _, u := range units {
+		if num, ok := strings.CutSuffix(upper, u.suffix); ok {
+			n, err := strconv.ParseFloat(num, 64)
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("invalid size %q", s)
+			}
+			return int64(n * float64(int64(1)<<u.shift)), nil
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSuffix(upper, "B"), 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n, nil
+}
@@ -0,0 +1,263 @@
+//go:build linux
+
+package rsh
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// cpu.max 的周期，单位微秒
+const cgroupCPUPeriod = 100000
+
+// 设置了 rlimit 时命令由服务端重新执行自身启动，argv[0] 为该值时设置 rlimit 后 exec 命令
+const rlimitExecArg0 = "rsh-rlimit-exec"
+
+// limitState 是会话的 cgroup 和 rlimit，未设置资源限制时为零值
+type limitState struct {
+	cgroup  string   // 会话的 cgroup 目录
+	fd      *os.File // 打开的 cgroup 目录，用于 SysProcAttr.CgroupFD
+	rlimits []rlimit // exec 命令前设置的 rlimit
+}
+
+// rlimit 是 exec 命令前设置的资源限制
+type rlimit struct {
+	Resource int
+	Cur, Max uint64
+}
+
+// rlimitExecSpec 是传给 rlimit 包装进程的参数
+type rlimitExecSpec struct {
+	Path    string
+	Args    []string // 包括 argv[0]
+	Rlimits []rlimit
+	// 进入目标进程的 mount namespace 时由包装进程 chroot，之后再切换工作目录 Dir 和用户 Credential
+	Chroot     string
+	Dir        string
+	Credential *syscall.Credential
+}
+
+func init() {
+	if len(os.Args) == 2 && os.Args[0] == rlimitExecArg0 {
+		os.Exit(runRlimitExec(os.Args[1]))
+	}
+}
+
+// prepareLimits 在启动命令前为会话创建 cgroup，命令通过 clone3 直接在该 cgroup 中启动，并确定需要的 rlimit。
+// cgroup 不可用时记录告警，只使用 rlimit。需要在 prepareSandbox 之前调用。
+func (s *session) prepareLimits() {
+	l := s.server.limits
+	if l == nil {
+		return
+	}
+	if l.CgroupParent != "" && (l.CPUQuota > 0 || l.Memory > 0 || l.Pids > 0) {
+		s.prepareCgroup(l)
+	}
+	s.limitState.rlimits = l.rlimits(s.limitState.cgroup != "")
+}
+
+// prepareCgroup 创建会话的 cgroup
+func (s *session) prepareCgroup(l *ResourceLimits) {
+	dir, err := createCgroup(l, "rsh-"+s.id)
+	if err != nil {
+		slog.Warn("Cgroup unavailable, using rlimits only", slog.String("parent", l.CgroupParent), slog.Any("err", err))
+		return
+	}
+	fd, err := os.Open(dir)
+	if err != nil {
+		slog.Warn("Cgroup unavailable, using rlimits only", slog.String("cgroup", dir), slog.Any("err", err))
+		os.Remove(dir)
+		return
+	}
+
+	s.limitState.cgroup, s.limitState.fd = dir, fd
+	s.cmd.SysProcAttr.UseCgroupFD = true
+	s.cmd.SysProcAttr.CgroupFD = int(fd.Fd())
+}
+
+// createCgroup 在 l.CgroupParent 中创建名为 name 的 cgroup 并写入限制
+func createCgroup(l *ResourceLimits, name string) (string, error) {
+	// 在父 cgroup 中启用需要的控制器，已经启用时写入不会出错
+	for _, c := range []struct {
+		name string
+		used bool
+	}{{"cpu", l.CPUQuota > 0}, {"memory", l.Memory > 0}, {"pids", l.Pids > 0}} {
+		if !c.used {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(l.CgroupParent, "cgroup.subtree_control"), []byte("+"+c.name), 0); err != nil {
+			return "", fmt.Errorf("enable %s controller: %v", c.name, err)
+		}
+	}
+
+	dir := filepath.Join(l.CgroupParent, name)
+	if err := os.Mkdir(dir, 0755); err != nil {
+		return "", err
+	}
+
+	var files [][2]string
+	if l.CPUQuota > 0 {
+		files = append(files, [2]string{"cpu.max", fmt.Sprintf("%d %d", int64(l.CPUQuota*cgroupCPUPeriod), cgroupCPUPeriod)})
+	}
+	if l.Memory > 0 {
+		files = append(files, [2]string{"memory.max", strconv.FormatInt(l.Memory, 10)})
+		// 不允许使用 swap 绕过内存限制，未启用 swap 时没有该文件
+		if _, err := os.Stat(filepath.Join(dir, "memory.swap.max")); err == nil {
+			files = append(files, [2]string{"memory.swap.max", "0"})
+		}
+	}
+	if l.Pids > 0 {
+		files = append(files, [2]string{"pids.max", strconv.FormatInt(l.Pids, 10)})
+	}
+	for _, f := range files {
+		if err := os.WriteFile(filepath.Join(dir, f[0]), []byte(f[1]), 0); err != nil {
+			os.Remove(dir)
+			return "", fmt.Errorf("write %s: %v", f[0], err)
+		}
+	}
+	return dir, nil
+}
+
+// rlimits 返回每个进程的 rlimit，有 cgroup 时内存由 cgroup 限制
+func (l *ResourceLimits) rlimits(cgroup bool) []rlimit {
+	var limits []rlimit
+	if l.OpenFiles > 0 {
+		limits = append(limits, rlimit{unix.RLIMIT_NOFILE, l.OpenFiles, l.OpenFiles})
+	}
+	if l.CPUTime > 0 {
+		// 超过软限制时收到 SIGXCPU，忽略该信号的进程在硬限制时被 SIGKILL
+		secs := uint64((l.CPUTime + time.Second - 1) / time.Second)
+		limits = append(limits, rlimit{unix.RLIMIT_CPU, secs, secs + 1})
+	}
+	if l.Memory > 0 && !cgroup {
+		limits = append(limits, rlimit{unix.RLIMIT_AS, uint64(l.Memory), uint64(l.Memory)})
+	}
+	return limits
+}
+
+// prepareRlimits 需要 rlimit 时将 s.cmd 改为重新执行服务端自身，包装进程设置 rlimit 后 exec 命令。
+// os/exec 不能在 exec 前设置子进程的 rlimit，启动后通过 prlimit 设置时，命令在此之前创建的子进程不受限制。
+// 沙箱中的命令由沙箱设置 rlimit；命令不存在时不包装，由 Start 返回 exec.ErrNotFound。需要在 prepareTarget 之后调用。
+func (s *session) prepareRlimits() error {
+	if len(s.limitState.rlimits) == 0 || s.sandbox != nil || s.cmd.Err != nil {
+		return nil
+	}
+
+	attr := s.cmd.SysProcAttr
+	spec := &rlimitExecSpec{Path: s.cmd.Path, Args: s.cmd.Args, Rlimits: s.limitState.rlimits}
+	if attr.Chroot != "" {
+		// chroot 后无法访问 /proc/self/exe，由包装进程 chroot，之后才能切换用户
+		spec.Chroot, spec.Dir, spec.Credential = attr.Chroot, s.cmd.Dir, attr.Credential
+		attr.Chroot, attr.Credential = "", nil
+		s.cmd.Dir = ""
+	}
+
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+	s.cmd.Path = "/proc/self/exe"
+	s.cmd.Args = []string{rlimitExecArg0, string(data)}
+	return nil
+}
+
+// runRlimitExec 设置 rlimit 后 exec 命令，只在失败时返回退出码
+func runRlimitExec(arg string) int {
+	spec := &rlimitExecSpec{}
+	if err := json.Unmarshal([]byte(arg), spec); err != nil {
+		fmt.Fprintf(os.Stderr, "rsh: %v\n", err)
+		return execSetupExitCode
+	}
+	if spec.Chroot != "" {
+		dir := spec.Dir
+		if dir == "" {
+			dir = "/"
+		}
+		if err := unix.Chroot(spec.Chroot); err != nil {
+			fmt.Fprintf(os.Stderr, "rsh: chroot %s: %v\n", spec.Chroot, err)
+			return execSetupExitCode
+		}
+		if err := os.Chdir(dir); err != nil {
+			fmt.Fprintf(os.Stderr, "rsh: %v\n", err)
+			return execSetupExitCode
+		}
+	}
+
+	err := execWithLimits(spec.Path, spec.Args, spec.Credential, spec.Rlimits, false)
+	fmt.Fprintf(os.Stderr, "rsh: %s: %v\n", spec.Path, err)
+	return execFailedExitCode
+}
+
+// finishLimits 在命令结束后返回被终止的原因 (Output.LimitExceeded)，并结束 cgroup 中剩余的进程、删除 cgroup。
+// 可以重复调用，之后的调用返回空字符串。
+func (s *session) finishLimits() string {
+	l := s.server.limits
+	if l == nil || s.cmd == nil {
+		return ""
+	}
+
+	var exceeded string
+	if ps := s.cmd.ProcessState; ps != nil && l.CPUTime > 0 {
+		if ws, ok := ps.Sys().(syscall.WaitStatus); ok && ws.Signaled() &&
+			(ws.Signal() == syscall.SIGXCPU || ws.Signal() == syscall.SIGKILL) &&
+			ps.UserTime()+ps.SystemTime() >= l.CPUTime-time.Second {
+			exceeded = LimitCPU
+		}
+	}
+
+	st := s.limitState
+	s.limitState = limitState{}
+	if st.cgroup == "" {
+		return exceeded
+	}
+	st.fd.Close()
+
+	if n, err := cgroupEvent(st.cgroup, "memory.events", "oom_kill"); err == nil && n > 0 {
+		exceeded = LimitMemory
+	}
+
+	// 后台进程可能还在运行，cgroup.kill 需要 5.14 以上的内核
+	os.WriteFile(filepath.Join(st.cgroup, "cgroup.kill"), []byte("1"), 0)
+	for i := 0; ; i++ {
+		err := os.Remove(st.cgroup)
+		if err == nil || errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		if i == 20 {
+			slog.Warn("Error removing cgroup", slog.String("cgroup", st.cgroup), slog.Any("err", err))
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return exceeded
+}
+
+// cgroupEvent 读取 cgroup 的 *.events 文件中 key 的计数
+func cgroupEvent(dir, file, key string) (int64, error) {
+	f, err := os.Open(filepath.Join(dir, file))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		k, v, ok := strings.Cut(scanner.Text(), " ")
+		if ok && k == key {
+			return strconv.ParseInt(v, 10, 64)
+		}
+	}
+	return 0, scanner.Err()
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package rsh
+
+// 资源限制只在 Linux 上生效，其他平台只支持 WallTime
+type limitState struct{}
+
+func (s *session) prepareLimits() {}
+
+func (s *session) prepareRlimits() error { return nil }
+
+func (s *session) finishLimits() string { return "" }
@@ -0,0 +1,42 @@
+package rsh
+
+import "testing"
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{in: "0", want: 0},
+		{in: "1048576", want: 1 << 20},
+		{in: "512B", want: 512},
+		{in: "1K", want: 1 << 10},
+		{in: "512M", want: 512 << 20},
+		{in: "512m", want: 512 << 20},
+		{in: "2G", want: 2 << 30},
+		{in: "2GB", want: 2 << 30},
+		{in: "2GiB", want: 2 << 30},
+		{in: "1T", want: 1 << 40},
+		{in: "1.5G", want: 3 << 29},
+		{in: " 64M ", want: 64 << 20},
+		{in: "", wantErr: true},
+		{in: "M", wantErr: true},
+		{in: "-1", wantErr: true},
+		{in: "-1G", wantErr: true},
+		{in: "12X", wantErr: true},
+		{in: "1e3", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseByteSize(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseByteSize(%q) = %d, want error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseByteSize(%q) = %d, %v, want %d", tt.in, got, err, tt.want)
+		}
+	}
+}
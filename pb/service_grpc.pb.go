@@ -1,6 +1,6 @@
 // Code generated by protoc-gen-go-grpc. DO NOT EDIT.
 // versions:
-// - protoc-gen-go-grpc v1.4.0
+// - protoc-gen-go-grpc v1.5.1
 // - protoc             v5.29.2
 // source: pb/service.proto
 
@@ -19,7 +19,14 @@ import (
 const _ = grpc.SupportPackageIsVersion8
 
 const (
-	RemoteShell_Session_FullMethodName = "/rsh.RemoteShell/Session"
+	RemoteShell_Session_FullMethodName       = "/rsh.RemoteShell/Session"
+	RemoteShell_Upload_FullMethodName        = "/rsh.RemoteShell/Upload"
+	RemoteShell_Download_FullMethodName      = "/rsh.RemoteShell/Download"
+	RemoteShell_Attach_FullMethodName        = "/rsh.RemoteShell/Attach"
+	RemoteShell_ListSessions_FullMethodName  = "/rsh.RemoteShell/ListSessions"
+	RemoteShell_KillSession_FullMethodName   = "/rsh.RemoteShell/KillSession"
+	RemoteShell_Forward_FullMethodName       = "/rsh.RemoteShell/Forward"
+	RemoteShell_ListenForward_FullMethodName = "/rsh.RemoteShell/ListenForward"
 )
 
 // RemoteShellClient is the client API for RemoteShell service.
@@ -27,6 +34,16 @@ const (
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type RemoteShellClient interface {
 	Session(ctx context.Context, opts ...grpc.CallOption) (RemoteShell_SessionClient, error)
+	Upload(ctx context.Context, opts ...grpc.CallOption) (RemoteShell_UploadClient, error)
+	Download(ctx context.Context, in *FileRequest, opts ...grpc.CallOption) (RemoteShell_DownloadClient, error)
+	// 重新附加到可分离的终端会话，第一个 Input 的 SessionId 指定会话
+	Attach(ctx context.Context, opts ...grpc.CallOption) (RemoteShell_AttachClient, error)
+	ListSessions(ctx context.Context, in *ListSessionsRequest, opts ...grpc.CallOption) (*SessionList, error)
+	KillSession(ctx context.Context, in *KillSessionRequest, opts ...grpc.CallOption) (*SessionInfo, error)
+	// TCP 端口转发，每个连接一个流，第一条消息指定目标地址或 ListenForward 接受的连接
+	Forward(ctx context.Context, opts ...grpc.CallOption) (RemoteShell_ForwardClient, error)
+	// 在服务端监听，每接受一个连接返回一个 ForwardEvent，客户端再通过 Forward 认领 (类似 ssh -R)
+	ListenForward(ctx context.Context, in *ListenRequest, opts ...grpc.CallOption) (RemoteShell_ListenForwardClient, error)
 }
 
 type remoteShellClient struct {
@@ -69,22 +86,242 @@ func (x *remoteShellSessionClient) Recv() (*Output, error) {
 	return m, nil
 }
 
+func (c *remoteShellClient) Upload(ctx context.Context, opts ...grpc.CallOption) (RemoteShell_UploadClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &RemoteShell_ServiceDesc.Streams[1], RemoteShell_Upload_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &remoteShellUploadClient{ClientStream: stream}
+	return x, nil
+}
+
+type RemoteShell_UploadClient interface {
+	Send(*FileChunk) error
+	CloseAndRecv() (*FileStatus, error)
+	grpc.ClientStream
+}
+
+type remoteShellUploadClient struct {
+	grpc.ClientStream
+}
+
+func (x *remoteShellUploadClient) Send(m *FileChunk) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *remoteShellUploadClient) CloseAndRecv() (*FileStatus, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(FileStatus)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *remoteShellClient) Download(ctx context.Context, in *FileRequest, opts ...grpc.CallOption) (RemoteShell_DownloadClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &RemoteShell_ServiceDesc.Streams[2], RemoteShell_Download_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &remoteShellDownloadClient{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type RemoteShell_DownloadClient interface {
+	Recv() (*FileChunk, error)
+	grpc.ClientStream
+}
+
+type remoteShellDownloadClient struct {
+	grpc.ClientStream
+}
+
+func (x *remoteShellDownloadClient) Recv() (*FileChunk, error) {
+	m := new(FileChunk)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *remoteShellClient) Attach(ctx context.Context, opts ...grpc.CallOption) (RemoteShell_AttachClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &RemoteShell_ServiceDesc.Streams[3], RemoteShell_Attach_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &remoteShellAttachClient{ClientStream: stream}
+	return x, nil
+}
+
+type RemoteShell_AttachClient interface {
+	Send(*Input) error
+	Recv() (*Output, error)
+	grpc.ClientStream
+}
+
+type remoteShellAttachClient struct {
+	grpc.ClientStream
+}
+
+func (x *remoteShellAttachClient) Send(m *Input) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *remoteShellAttachClient) Recv() (*Output, error) {
+	m := new(Output)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *remoteShellClient) ListSessions(ctx context.Context, in *ListSessionsRequest, opts ...grpc.CallOption) (*SessionList, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SessionList)
+	err := c.cc.Invoke(ctx, RemoteShell_ListSessions_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *remoteShellClient) KillSession(ctx context.Context, in *KillSessionRequest, opts ...grpc.CallOption) (*SessionInfo, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SessionInfo)
+	err := c.cc.Invoke(ctx, RemoteShell_KillSession_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *remoteShellClient) Forward(ctx context.Context, opts ...grpc.CallOption) (RemoteShell_ForwardClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &RemoteShell_ServiceDesc.Streams[4], RemoteShell_Forward_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &remoteShellForwardClient{ClientStream: stream}
+	return x, nil
+}
+
+type RemoteShell_ForwardClient interface {
+	Send(*ForwardData) error
+	Recv() (*ForwardData, error)
+	grpc.ClientStream
+}
+
+type remoteShellForwardClient struct {
+	grpc.ClientStream
+}
+
+func (x *remoteShellForwardClient) Send(m *ForwardData) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *remoteShellForwardClient) Recv() (*ForwardData, error) {
+	m := new(ForwardData)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *remoteShellClient) ListenForward(ctx context.Context, in *ListenRequest, opts ...grpc.CallOption) (RemoteShell_ListenForwardClient, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &RemoteShell_ServiceDesc.Streams[5], RemoteShell_ListenForward_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &remoteShellListenForwardClient{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type RemoteShell_ListenForwardClient interface {
+	Recv() (*ForwardEvent, error)
+	grpc.ClientStream
+}
+
+type remoteShellListenForwardClient struct {
+	grpc.ClientStream
+}
+
+func (x *remoteShellListenForwardClient) Recv() (*ForwardEvent, error) {
+	m := new(ForwardEvent)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // RemoteShellServer is the server API for RemoteShell service.
 // All implementations must embed UnimplementedRemoteShellServer
-// for forward compatibility
+// for forward compatibility.
 type RemoteShellServer interface {
 	Session(RemoteShell_SessionServer) error
+	Upload(RemoteShell_UploadServer) error
+	Download(*FileRequest, RemoteShell_DownloadServer) error
+	// 重新附加到可分离的终端会话，第一个 Input 的 SessionId 指定会话
+	Attach(RemoteShell_AttachServer) error
+	ListSessions(context.Context, *ListSessionsRequest) (*SessionList, error)
+	KillSession(context.Context, *KillSessionRequest) (*SessionInfo, error)
+	// TCP 端口转发，每个连接一个流，第一条消息指定目标地址或 ListenForward 接受的连接
+	Forward(RemoteShell_ForwardServer) error
+	// 在服务端监听，每接受一个连接返回一个 ForwardEvent，客户端再通过 Forward 认领 (类似 ssh -R)
+	ListenForward(*ListenRequest, RemoteShell_ListenForwardServer) error
 	mustEmbedUnimplementedRemoteShellServer()
 }
 
-// UnimplementedRemoteShellServer must be embedded to have forward compatible implementations.
-type UnimplementedRemoteShellServer struct {
-}
+// UnimplementedRemoteShellServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedRemoteShellServer struct{}
 
 func (UnimplementedRemoteShellServer) Session(RemoteShell_SessionServer) error {
 	return status.Errorf(codes.Unimplemented, "method Session not implemented")
 }
+func (UnimplementedRemoteShellServer) Upload(RemoteShell_UploadServer) error {
+	return status.Errorf(codes.Unimplemented, "method Upload not implemented")
+}
+func (UnimplementedRemoteShellServer) Download(*FileRequest, RemoteShell_DownloadServer) error {
+	return status.Errorf(codes.Unimplemented, "method Download not implemented")
+}
+func (UnimplementedRemoteShellServer) Attach(RemoteShell_AttachServer) error {
+	return status.Errorf(codes.Unimplemented, "method Attach not implemented")
+}
+func (UnimplementedRemoteShellServer) ListSessions(context.Context, *ListSessionsRequest) (*SessionList, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListSessions not implemented")
+}
+func (UnimplementedRemoteShellServer) KillSession(context.Context, *KillSessionRequest) (*SessionInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method KillSession not implemented")
+}
+func (UnimplementedRemoteShellServer) Forward(RemoteShell_ForwardServer) error {
+	return status.Errorf(codes.Unimplemented, "method Forward not implemented")
+}
+func (UnimplementedRemoteShellServer) ListenForward(*ListenRequest, RemoteShell_ListenForwardServer) error {
+	return status.Errorf(codes.Unimplemented, "method ListenForward not implemented")
+}
 func (UnimplementedRemoteShellServer) mustEmbedUnimplementedRemoteShellServer() {}
+func (UnimplementedRemoteShellServer) testEmbeddedByValue()                     {}
 
 // UnsafeRemoteShellServer may be embedded to opt out of forward compatibility for this service.
 // Use of this interface is not recommended, as added methods to RemoteShellServer will
@@ -94,6 +331,13 @@ type UnsafeRemoteShellServer interface {
 }
 
 func RegisterRemoteShellServer(s grpc.ServiceRegistrar, srv RemoteShellServer) {
+	// If the following call pancis, it indicates UnimplementedRemoteShellServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
 	s.RegisterService(&RemoteShell_ServiceDesc, srv)
 }
 
@@ -123,13 +367,178 @@ func (x *remoteShellSessionServer) Recv() (*Input, error) {
 	return m, nil
 }
 
+func _RemoteShell_Upload_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(RemoteShellServer).Upload(&remoteShellUploadServer{ServerStream: stream})
+}
+
+type RemoteShell_UploadServer interface {
+	SendAndClose(*FileStatus) error
+	Recv() (*FileChunk, error)
+	grpc.ServerStream
+}
+
+type remoteShellUploadServer struct {
+	grpc.ServerStream
+}
+
+func (x *remoteShellUploadServer) SendAndClose(m *FileStatus) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *remoteShellUploadServer) Recv() (*FileChunk, error) {
+	m := new(FileChunk)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _RemoteShell_Download_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(FileRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(RemoteShellServer).Download(m, &remoteShellDownloadServer{ServerStream: stream})
+}
+
+type RemoteShell_DownloadServer interface {
+	Send(*FileChunk) error
+	grpc.ServerStream
+}
+
+type remoteShellDownloadServer struct {
+	grpc.ServerStream
+}
+
+func (x *remoteShellDownloadServer) Send(m *FileChunk) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _RemoteShell_Attach_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(RemoteShellServer).Attach(&remoteShellAttachServer{ServerStream: stream})
+}
+
+type RemoteShell_AttachServer interface {
+	Send(*Output) error
+	Recv() (*Input, error)
+	grpc.ServerStream
+}
+
+type remoteShellAttachServer struct {
+	grpc.ServerStream
+}
+
+func (x *remoteShellAttachServer) Send(m *Output) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *remoteShellAttachServer) Recv() (*Input, error) {
+	m := new(Input)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _RemoteShell_ListSessions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListSessionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RemoteShellServer).ListSessions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RemoteShell_ListSessions_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RemoteShellServer).ListSessions(ctx, req.(*ListSessionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RemoteShell_KillSession_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KillSessionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(RemoteShellServer).KillSession(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: RemoteShell_KillSession_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(RemoteShellServer).KillSession(ctx, req.(*KillSessionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _RemoteShell_Forward_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(RemoteShellServer).Forward(&remoteShellForwardServer{ServerStream: stream})
+}
+
+type RemoteShell_ForwardServer interface {
+	Send(*ForwardData) error
+	Recv() (*ForwardData, error)
+	grpc.ServerStream
+}
+
+type remoteShellForwardServer struct {
+	grpc.ServerStream
+}
+
+func (x *remoteShellForwardServer) Send(m *ForwardData) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *remoteShellForwardServer) Recv() (*ForwardData, error) {
+	m := new(ForwardData)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _RemoteShell_ListenForward_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListenRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(RemoteShellServer).ListenForward(m, &remoteShellListenForwardServer{ServerStream: stream})
+}
+
+type RemoteShell_ListenForwardServer interface {
+	Send(*ForwardEvent) error
+	grpc.ServerStream
+}
+
+type remoteShellListenForwardServer struct {
+	grpc.ServerStream
+}
+
+func (x *remoteShellListenForwardServer) Send(m *ForwardEvent) error {
+	return x.ServerStream.SendMsg(m)
+}
+
 // RemoteShell_ServiceDesc is the grpc.ServiceDesc for RemoteShell service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
 var RemoteShell_ServiceDesc = grpc.ServiceDesc{
 	ServiceName: "rsh.RemoteShell",
 	HandlerType: (*RemoteShellServer)(nil),
-	Methods:     []grpc.MethodDesc{},
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListSessions",
+			Handler:    _RemoteShell_ListSessions_Handler,
+		},
+		{
+			MethodName: "KillSession",
+			Handler:    _RemoteShell_KillSession_Handler,
+		},
+	},
 	Streams: []grpc.StreamDesc{
 		{
 			StreamName:    "Session",
@@ -137,6 +546,33 @@ var RemoteShell_ServiceDesc = grpc.ServiceDesc{
 			ServerStreams: true,
 			ClientStreams: true,
 		},
+		{
+			StreamName:    "Upload",
+			Handler:       _RemoteShell_Upload_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Download",
+			Handler:       _RemoteShell_Download_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Attach",
+			Handler:       _RemoteShell_Attach_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "Forward",
+			Handler:       _RemoteShell_Forward_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "ListenForward",
+			Handler:       _RemoteShell_ListenForward_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "pb/service.proto",
 }
@@ -0,0 +1,308 @@
+package rsh
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"syscall"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v3"
+)
+
+// PolicyAction 是策略对一次命令执行的决定
+type PolicyAction string
+
+const (
+	PolicyAllow PolicyAction = "allow"
+	PolicyDeny  PolicyAction = "deny"
+	PolicyAudit PolicyAction = "audit" // 允许执行，同时记录告警日志
+)
+
+// Policy 是策略文件的内容，YAML 或 JSON 格式。
+// 规则按顺序匹配，第一条匹配的规则生效，都不匹配时使用 Default，Default 为空时拒绝。
+type Policy struct {
+	Default PolicyAction `yaml:"default"`
+	Rules   []PolicyRule `yaml:"rules"`
+}
+
+// PolicyRule 的所有非空条件都满足时匹配。
+// Identities、ClientIDs、Commands 支持 path.Match 通配符，Args 为正则表达式，匹配空格连接后的参数。
+type PolicyRule struct {
+	Name       string       `yaml:"name"`
+	Identities []string     `yaml:"identities"` // 调用方身份: 证书 CN 或 token subject
+	ClientIDs  []string     `yaml:"clientIds"`  // 反向隧道 agent 的 client-id
+	Commands   []string     `yaml:"commands"`   // 命令，同时匹配原始命令和 PolicyRequest.Path
+	Args       []string     `yaml:"args"`
+	Terminal   *bool        `yaml:"terminal"`
+	Action     PolicyAction `yaml:"action"`
+	Profile    string       `yaml:"profile"` // 允许的命令在该沙箱 profile 中运行，见 WithSandbox
+
+	args []*regexp.Regexp
+}
+
+// PolicyRequest 是一次待授权的命令执行。
+// 文件传输和端口转发等非命令请求使用 "@" 开头的伪命令，如 "@upload"、"@forward"。
+type PolicyRequest struct {
+	Identity string
+	ClientID string
+	Command  string
+	// Path 为命令按会话的 PATH 和工作目录解析出的路径，为空时在服务端的 PATH 中查找
+	Path     string
+	Args     []string
+	Terminal bool
+}
+
+// PolicyDecision 是策略的评估结果，Rule 为匹配的规则名，Profile 为规则要求的沙箱 profile。
+type PolicyDecision struct {
+	Action  PolicyAction
+	Rule    string
+	Profile string
+}
+
+// PolicyEngine 从文件加载策略，可以在收到 SIGHUP 时重新加载。
+type PolicyEngine struct {
+	path   string
+	mu     sync.RWMutex
+	policy *Policy
+}
+
+// LoadPolicy 从 YAML 或 JSON 文件加载策略。
+func LoadPolicy(path string) (*PolicyEngine, error) {
+	e := &PolicyEngine{path: path}
+	if err := e.Reload(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Reload 重新读取策略文件，出错时保留原有策略。
+func (e *PolicyEngine) Reload() error {
+	data, err := os.ReadFile(e.path)
+	if err != nil {
+		return err
+	}
+
+	p := &Policy{}
+	if err := yaml.Unmarshal(data, p); err != nil {
+		return fmt.Errorf("parse policy %s: %v", e.path, err)
+	}
+	if err := p.compile(); err != nil {
+		return fmt.Errorf("policy %s: %v", e.path, err)
+	}
+
+	e.mu.Lock()
+	e.policy = p
+	e.mu.Unlock()
+
+	slog.Info("Policy loaded", slog.String("path", e.path), slog.Int("rules", len(p.Rules)))
+	return nil
+}
+
+// ReloadOnSIGHUP 在后台监听 SIGHUP 并重新加载策略。
+func (e *PolicyEngine) ReloadOnSIGHUP() {
+	sigc := make(chan os.Signal, 1)
+	signal.Notify(sigc, syscall.SIGHUP)
+
+	go func() {
+		for range sigc {
+			if err := e.Reload(); err != nil {
+				slog.Error("Error reloading policy:", slog.Any("err", err))
+			}
+		}
+	}()
+}
+
+// Evaluate 返回 req 的授权决定。
+func (e *PolicyEngine) Evaluate(req *PolicyRequest) PolicyDecision {
+	return e.evaluate(req, nil)
+}
+
+// evaluate 与 Evaluate 相同。explicit 不为 nil 时只有 explicit 返回 true 的规则可以允许，
+// 匹配的其他 allow、audit 规则被跳过，deny 规则仍然生效，都不匹配时拒绝，不使用 Default
+func (e *PolicyEngine) evaluate(req *PolicyRequest, explicit func(*PolicyRule) bool) PolicyDecision {
+	e.mu.RLock()
+	p := e.policy
+	e.mu.RUnlock()
+
+	commands := []string{req.Command}
+	if !strings.HasPrefix(req.Command, "@") {
+		resolved := req.Path
+		if resolved == "" {
+			resolved, _ = exec.LookPath(req.Command)
+		}
+		if resolved != "" && resolved != req.Command {
+			commands = append(commands, resolved)
+		}
+	}
+
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if !r.match(req, commands) {
+			continue
+		}
+		if explicit != nil && r.Action != PolicyDeny && !explicit(r) {
+			continue
+		}
+		return PolicyDecision{Action: r.Action, Rule: r.Name, Profile: r.Profile}
+	}
+
+	if explicit != nil {
+		return PolicyDecision{Action: PolicyDeny}
+	}
+	return PolicyDecision{Action: p.Default}
+}
+
+func (p *Policy) compile() error {
+	if p.Default == "" {
+		p.Default = PolicyDeny
+	}
+	if !p.Default.valid() {
+		return fmt.Errorf("invalid default action %q", p.Default)
+	}
+
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule-%d", i+1)
+		}
+		if !r.Action.valid() {
+			return fmt.Errorf("rule %s: invalid action %q", r.Name, r.Action)
+		}
+		for _, pattern := range append(append(append([]string{}, r.Identities...), r.ClientIDs...), r.Commands...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("rule %s: invalid pattern %q: %v", r.Name, pattern, err)
+			}
+		}
+		for _, expr := range r.Args {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return fmt.Errorf("rule %s: invalid args pattern %q: %v", r.Name, expr, err)
+			}
+			r.args = append(r.args, re)
+		}
+	}
+	return nil
+}
+
+func (a PolicyAction) valid() bool {
+	return a == PolicyAllow || a == PolicyDeny || a == PolicyAudit
+}
+
+func (r *PolicyRule) match(req *PolicyRequest, commands []string) bool {
+	if len(r.Identities) > 0 && !matchAny(r.Identities, req.Identity) {
+		return false
+	}
+	if len(r.ClientIDs) > 0 && !matchAny(r.ClientIDs, req.ClientID) {
+		return false
+	}
+	if len(r.Commands) > 0 && !matchAny(r.Commands, commands...) {
+		return false
+	}
+	if r.Terminal != nil && *r.Terminal != req.Terminal {
+		return false
+	}
+	if len(r.args) > 0 {
+		args := strings.Join(req.Args, " ")
+		matched := false
+		for _, re := range r.args {
+			if re.MatchString(args) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// matchAny 判断 values 中是否有任意一个匹配 patterns 中的通配符
+func matchAny(patterns []string, values ...string) bool {
+	for _, pattern := range patterns {
+		for _, v := range values {
+			if ok, _ := path.Match(pattern, v); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// callerIdentity 返回调用方身份。
+// Server 上由拦截器认证得到；反向隧道上没有拦截器，使用 ReverseServer 转发的 rsh-identity 元数据。
+func callerIdentity(ctx context.Context) string {
+	if id, ok := IdentityFromContext(ctx); ok {
+		return id.Name()
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if v := md.Get("rsh-identity"); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// authorize 按策略检查是否允许执行 "@" 开头的伪命令，未配置策略时允许所有请求。
+// 伪命令不能在沙箱中运行，匹配的规则要求沙箱 profile 时拒绝，否则受限的身份可以绕过沙箱
+func (s *rshServer) authorize(ctx context.Context, command string, args []string, terminal bool) error {
+	return s.authorizeExplicit(ctx, command, args, terminal, nil)
+}
+
+// authorizeExplicit 与 authorize 相同，explicit 不为 nil 时只有它接受的规则可以允许，见 PolicyEngine.evaluate
+func (s *rshServer) authorizeExplicit(ctx context.Context, command string, args []string, terminal bool, explicit func(*PolicyRule) bool) error {
+	d, err := s.evaluate(ctx, command, "", args, terminal, explicit)
+	if err != nil {
+		return err
+	}
+	if d.Profile != "" {
+		slog.Warn("Policy denied command, sandbox profile cannot be applied", slog.String("identity", callerIdentity(ctx)),
+			slog.String("command", command), slog.String("rule", d.Rule), slog.String("profile", d.Profile))
+		return status.Errorf(codes.PermissionDenied, "%s: denied by policy, rule %s requires sandbox profile %s", command, d.Rule, d.Profile)
+	}
+	return nil
+}
+
+// evaluate 按策略检查命令并返回策略的决定，未配置策略时返回零值。resolved 为命令解析出的路径，见 PolicyRequest.Path；
+// explicit 见 PolicyEngine.evaluate
+func (s *rshServer) evaluate(ctx context.Context, command, resolved string, args []string, terminal bool, explicit func(*PolicyRule) bool) (PolicyDecision, error) {
+	if s.policy == nil {
+		return PolicyDecision{}, nil
+	}
+
+	req := &PolicyRequest{
+		Identity: callerIdentity(ctx),
+		ClientID: s.clientID,
+		Command:  command,
+		Path:     resolved,
+		Args:     args,
+		Terminal: terminal,
+	}
+	d := s.policy.evaluate(req, explicit)
+
+	attrs := []any{
+		slog.String("identity", req.Identity),
+		slog.String("client-id", req.ClientID),
+		slog.String("command", command),
+		slog.Any("args", args),
+		slog.Bool("terminal", terminal),
+		slog.String("rule", d.Rule),
+	}
+	switch d.Action {
+	case PolicyDeny:
+		slog.Warn("Policy denied command", attrs...)
+		return d, status.Errorf(codes.PermissionDenied, "%s: denied by policy", command)
+	case PolicyAudit:
+		slog.Warn("Policy audit", attrs...)
+	}
+	return d, nil
+}
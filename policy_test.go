@@ -0,0 +1,173 @@
+package rsh
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v3"
+)
+
+const testPolicy = `
+default: deny
+rules:
+  - name: ops
+    identities: ["ops-*"]
+    action: allow
+  - name: no-rm-rf
+    commands: ["/usr/bin/rm", "/bin/rm"]
+    args: ["(^| )-[a-z]*r[a-z]*f"]
+    action: deny
+  - name: usr-bin
+    commands: ["ls", "/usr/bin/*"]
+    terminal: false
+    action: audit
+  - name: sandboxed-python
+    commands: ["python3"]
+    action: allow
+    profile: net
+  - name: web-upload
+    clientIds: ["web-*"]
+    commands: ["@upload"]
+    action: allow
+`
+
+func TestPolicyEvaluate(t *testing.T) {
+	p := &Policy{}
+	if err := yaml.Unmarshal([]byte(testPolicy), p); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.compile(); err != nil {
+		t.Fatal(err)
+	}
+	e := &PolicyEngine{policy: p}
+
+	tests := []struct {
+		name string
+		req  PolicyRequest
+		want PolicyDecision
+	}{
+		{"identity wildcard", PolicyRequest{Identity: "ops-1", Command: "rm", Args: []string{"-rf", "/"}}, PolicyDecision{Action: PolicyAllow, Rule: "ops"}},
+		{"resolved path and args", PolicyRequest{Identity: "alice", Command: "rm", Path: "/usr/bin/rm", Args: []string{"-rf", "/"}}, PolicyDecision{Action: PolicyDeny, Rule: "no-rm-rf"}},
+		{"args do not match", PolicyRequest{Identity: "alice", Command: "rm", Path: "/usr/bin/rm", Args: []string{"-i", "x"}}, PolicyDecision{Action: PolicyAudit, Rule: "usr-bin"}},
+		{"absolute command", PolicyRequest{Identity: "alice", Command: "/usr/bin/cat"}, PolicyDecision{Action: PolicyAudit, Rule: "usr-bin"}},
+		{"resolved outside the rule", PolicyRequest{Identity: "alice", Command: "cat", Path: "/tmp/evil/cat"}, PolicyDecision{Action: PolicyDeny}},
+		{"terminal mismatch", PolicyRequest{Identity: "alice", Command: "cat", Path: "/usr/bin/cat", Terminal: true}, PolicyDecision{Action: PolicyDeny}},
+		{"profile", PolicyRequest{Identity: "alice", Command: "python3", Path: "/opt/python/bin/python3"}, PolicyDecision{Action: PolicyAllow, Rule: "sandboxed-python", Profile: "net"}},
+		{"client id", PolicyRequest{ClientID: "web-1", Command: "@upload"}, PolicyDecision{Action: PolicyAllow, Rule: "web-upload"}},
+		{"client id mismatch", PolicyRequest{ClientID: "db-1", Command: "@upload"}, PolicyDecision{Action: PolicyDeny}},
+		{"pseudo command", PolicyRequest{Identity: "alice", Command: "@download"}, PolicyDecision{Action: PolicyDeny}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := e.Evaluate(&tt.req); got != tt.want {
+				t.Fatalf("Evaluate(%+v) = %+v, want %+v", tt.req, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyCompile(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  Policy
+		wantErr bool
+	}{
+		{"empty", Policy{}, false},
+		{"invalid default", Policy{Default: "maybe"}, true},
+		{"invalid action", Policy{Rules: []PolicyRule{{Action: "permit"}}}, true},
+		{"missing action", Policy{Rules: []PolicyRule{{Commands: []string{"ls"}}}}, true},
+		{"invalid identity pattern", Policy{Rules: []PolicyRule{{Identities: []string{"["}, Action: PolicyAllow}}}, true},
+		{"invalid command pattern", Policy{Rules: []PolicyRule{{Commands: []string{"ls["}, Action: PolicyAllow}}}, true},
+		{"invalid args pattern", Policy{Rules: []PolicyRule{{Args: []string{"("}, Action: PolicyAllow}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.compile()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("compile: got err %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	p := &Policy{Rules: []PolicyRule{{Action: PolicyAllow}}}
+	if err := p.compile(); err != nil {
+		t.Fatal(err)
+	}
+	if p.Default != PolicyDeny || p.Rules[0].Name != "rule-1" {
+		t.Fatalf("defaults: got default %q and rule name %q", p.Default, p.Rules[0].Name)
+	}
+}
+
+func TestAuthorizePseudoCommandWithProfile(t *testing.T) {
+	p := &Policy{Rules: []PolicyRule{{Name: "sandboxed", Identities: []string{"contractor-*"}, Action: PolicyAllow, Profile: "restricted"}}}
+	if err := p.compile(); err != nil {
+		t.Fatal(err)
+	}
+	s := newRSHServer("", &serverOptions{policy: &PolicyEngine{policy: p}})
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("rsh-identity", "contractor-1"))
+
+	// 命令在沙箱中运行，伪命令不能放进沙箱，被拒绝
+	d, err := s.evaluate(ctx, "ls", "/usr/bin/ls", nil, false, nil)
+	if err != nil || d.Profile != "restricted" {
+		t.Fatalf("command: got %+v, %v, want profile restricted", d, err)
+	}
+	for _, command := range []string{"@attach", "@upload", "@download", "@forward", "@listen", "@nsenter"} {
+		if err := s.authorize(ctx, command, []string{"arg"}, true); status.Code(err) != codes.PermissionDenied {
+			t.Errorf("authorize %s: got %v, want PermissionDenied", command, err)
+		}
+	}
+
+	// 示例策略中的 contractors 不能加入其他人的会话
+	e, err := LoadPolicy("examples/policy.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s = newRSHServer("", &serverOptions{policy: e})
+	if err := s.authorize(ctx, "@attach", []string{"s1", "read-write"}, true); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("example policy @attach: got %v, want PermissionDenied", err)
+	}
+}
+
+func TestAuthorizeAttach(t *testing.T) {
+	attach := PolicyRule{Name: "attach", Commands: []string{"@attach"}, Action: PolicyAllow}
+	attachRW := PolicyRule{Name: "attach-rw", Commands: []string{"@attach"}, Args: []string{"read-write$"}, Action: PolicyAllow}
+
+	tests := []struct {
+		name                string
+		policy              Policy
+		readOnly, readWrite bool
+	}{
+		{name: "default allow", policy: Policy{Default: PolicyAllow}},
+		{name: "identity only", policy: Policy{Rules: []PolicyRule{{Identities: []string{"*"}, Action: PolicyAllow}}}},
+		{name: "wildcard command", policy: Policy{Rules: []PolicyRule{{Commands: []string{"@*"}, Args: []string{"."}, Action: PolicyAllow}}}},
+		{name: "audit catch-all", policy: Policy{Default: PolicyAllow, Rules: []PolicyRule{{Action: PolicyAudit}}}},
+		{name: "explicit without args", policy: Policy{Rules: []PolicyRule{attach}}, readOnly: true},
+		{name: "explicit with args", policy: Policy{Rules: []PolicyRule{attachRW}}, readWrite: true},
+		{name: "explicit after catch-all", policy: Policy{Rules: []PolicyRule{{Action: PolicyAllow}, attach, attachRW}}, readOnly: true, readWrite: true},
+		{name: "deny before explicit", policy: Policy{Rules: []PolicyRule{{Identities: []string{"alice"}, Action: PolicyDeny}, attach, attachRW}}},
+	}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("rsh-identity", "alice"))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := tt.policy
+			p.Rules = append([]PolicyRule(nil), p.Rules...)
+			if err := p.compile(); err != nil {
+				t.Fatal(err)
+			}
+			s := newRSHServer("", &serverOptions{policy: &PolicyEngine{policy: &p}})
+			for _, c := range []struct {
+				readOnly bool
+				want     bool
+			}{{true, tt.readOnly}, {false, tt.readWrite}} {
+				role := (&participant{readOnly: c.readOnly}).role()
+				err := s.authorizeExplicit(ctx, "@attach", []string{"s1", role}, true, attachRule(c.readOnly))
+				if (err == nil) != c.want {
+					t.Errorf("%s: got %v, want allowed %v", role, err, c.want)
+				}
+			}
+		})
+	}
+}
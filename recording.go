@@ -0,0 +1,221 @@
+package rsh
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// WithRecording 将终端会话以 asciicast v2 格式记录到 dir/<session-id>.cast，recordInput 时同时记录输入。
+func WithRecording(dir string, recordInput bool) ServerOption {
+	return func(o *serverOptions) {
+		o.recordDir = dir
+		o.recordInput = recordInput
+	}
+}
+
+// asciicastHeader 是 asciicast v2 文件的第一行
+type asciicastHeader struct {
+	Version   int               `json:"version"`
+	Width     uint16            `json:"width"`
+	Height    uint16            `json:"height"`
+	Timestamp int64             `json:"timestamp"`
+	Command   string            `json:"command,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// asciicastRecorder 记录终端的输出、输入和窗口大小变化。
+// 文件头需要窗口大小，在第一个事件时才写入，此前的 resize 只更新文件头中的大小。
+type asciicastRecorder struct {
+	mu          sync.Mutex
+	f           *os.File
+	w           *bufio.Writer
+	header      asciicastHeader
+	start       time.Time
+	started     bool
+	recordInput bool
+	pending     []byte // 输出中不完整的 UTF-8 字符，留到下一次输出
+}
+
+func newAsciicastRecorder(dir, sessionID string, recordInput bool, command string, env map[string]string) (*asciicastRecorder, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(filepath.Join(dir, sessionID+".cast"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	return &asciicastRecorder{
+		f: f,
+		w: bufio.NewWriter(f),
+		header: asciicastHeader{
+			Version:   2,
+			Width:     80,
+			Height:    24,
+			Timestamp: now.Unix(),
+			Command:   command,
+			Env:       env,
+		},
+		start:       now,
+		recordInput: recordInput,
+	}, nil
+}
+
+// Path 返回录像文件的路径
+func (r *asciicastRecorder) Path() string {
+	return r.f.Name()
+}
+
+// Write 记录输出，实现 io.Writer 以便与 pty 输出一起 tee
+func (r *asciicastRecorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data := append(r.pending, p...)
+	data, r.pending = splitIncompleteUTF8(data)
+	if len(data) > 0 {
+		r.event("o", string(data))
+	}
+	return len(p), nil
+}
+
+func (r *asciicastRecorder) input(p []byte) {
+	if !r.recordInput {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.event("i", string(p))
+}
+
+func (r *asciicastRecorder) resize(cols, rows uint16) {
+	// 客户端无法获取窗口大小时为 0，保留默认的 80x24
+	if cols == 0 || rows == 0 {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.started {
+		r.header.Width, r.header.Height = cols, rows
+		return
+	}
+	r.event("r", fmt.Sprintf("%dx%d", cols, rows))
+}
+
+func (r *asciicastRecorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.pending) > 0 {
+		r.event("o", string(r.pending))
+		r.pending = nil
+	}
+	r.writeHeader()
+	if err := r.w.Flush(); err != nil {
+		r.f.Close()
+		return err
+	}
+	return r.f.Close()
+}
+
+func (r *asciicastRecorder) writeHeader() {
+	if r.started {
+		return
+	}
+	r.started = true
+
+	data, _ := json.Marshal(r.header)
+	r.w.Write(append(data, '\n'))
+}
+
+// event 写入一个 [time, code, data] 事件，需要持有 r.mu
+func (r *asciicastRecorder) event(code, data string) {
+	r.writeHeader()
+
+	line, _ := json.Marshal([]any{time.Since(r.start).Seconds(), code, data})
+	r.w.Write(append(line, '\n'))
+}
+
+// splitIncompleteUTF8 将 p 末尾不完整的 UTF-8 字符分离出来
+func splitIncompleteUTF8(p []byte) ([]byte, []byte) {
+	// UTF-8 字符最长 4 字节，只需要检查最后 3 个字节
+	for i := 1; i <= 3 && i <= len(p); i++ {
+		c := p[len(p)-i]
+		if !utf8.RuneStart(c) {
+			continue
+		}
+		if !utf8.FullRune(p[len(p)-i:]) {
+			return p[:len(p)-i], append([]byte(nil), p[len(p)-i:]...)
+		}
+		break
+	}
+	return p, nil
+}
+
+// PlayAsciicast 按录制时的时间间隔将 asciicast v2 录像的输出写到 w。
+// speed 为播放倍速，maxIdle 大于 0 时限制两个事件之间的最长等待时间。
+func PlayAsciicast(r io.Reader, w io.Writer, speed float64, maxIdle time.Duration) error {
+	if speed <= 0 {
+		speed = 1
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+		return fmt.Errorf("empty recording")
+	}
+
+	var header asciicastHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		return fmt.Errorf("parse header: %v", err)
+	}
+	if header.Version != 2 {
+		return fmt.Errorf("unsupported asciicast version %d", header.Version)
+	}
+
+	var last float64
+	for scanner.Scan() {
+		var event []any
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return fmt.Errorf("parse event: %v", err)
+		}
+		if len(event) != 3 {
+			continue
+		}
+
+		t, _ := event[0].(float64)
+		code, _ := event[1].(string)
+		data, _ := event[2].(string)
+
+		delay := time.Duration((t - last) / speed * float64(time.Second))
+		if maxIdle > 0 && delay > maxIdle {
+			delay = maxIdle
+		}
+		time.Sleep(delay)
+		last = t
+
+		if code == "o" {
+			if _, err := io.WriteString(w, data); err != nil {
+				return err
+			}
+		}
+	}
+
+	return scanner.Err()
+}
@@ -17,16 +17,28 @@ type ReverseClient struct {
 	shell         string
 	tlsconfig     *tls.Config
 	channelServer *grpctunnel.ReverseTunnelServer
+	options       serverOptions
 }
 
 // NewReverseClient creates a new local shell client.
-func NewReverseClient(address string, shell string, tlcfg *tls.Config, channelServer *grpctunnel.ReverseTunnelServer) *ReverseClient {
-	return &ReverseClient{
+// opts 中与会话相关的选项(如 WithPolicy)作用于通过反向隧道执行的命令，TLS 和 token 选项不生效。
+func NewReverseClient(address string, shell string, tlcfg *tls.Config, channelServer *grpctunnel.ReverseTunnelServer, opts ...ServerOption) *ReverseClient {
+	s := &ReverseClient{
 		address:       address,
 		shell:         shell,
 		tlsconfig:     tlcfg,
 		channelServer: channelServer,
 	}
+	for _, opt := range opts {
+		opt(&s.options)
+	}
+	return s
+}
+
+func (s *ReverseClient) newRSHServer() *rshServer {
+	srv := newRSHServer(s.shell, &s.options)
+	srv.clientID = GetNodeID()
+	return srv
 }
 
 func (s *ReverseClient) Dialer() func(context.Context, string) (net.Conn, error) {
@@ -52,7 +64,7 @@ func (s *ReverseClient) Serve() error {
 		wg.Add(1)
 		func() {
 			defer wg.Done()
-			if err := tunnelRegister(context.Background(), nil, s.channelServer); err != nil {
+			if err := tunnelRegister(context.Background(), nil, s.channelServer, s.newRSHServer()); err != nil {
 				slog.Info("tunnelRegister error:", slog.Any("error", err))
 				return
 			}
@@ -71,7 +83,7 @@ func (s *ReverseClient) Serve() error {
 					return
 				}
 
-				if err := tunnelRegister(context.Background(), conn, nil); err != nil {
+				if err := tunnelRegister(context.Background(), conn, nil, s.newRSHServer()); err != nil {
 					slog.Info("tunnelRegister error:", slog.Any("error", err))
 					return
 				}
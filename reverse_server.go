@@ -1,24 +1,33 @@
 package rsh
 
 import (
+	"context"
 	"crypto/tls"
+	"fmt"
 	"github.com/alphadose/haxmap"
 	"github.com/gin-gonic/gin"
 	"github.com/jhump/grpctunnel"
 	"github.com/jhump/grpctunnel/tunnelpb"
+	"github.com/nxsre/go-rsh/pb"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
+	"io/fs"
 	"log/slog"
 	"strings"
 )
 
 type ReverseServer struct {
-	tlsconfig    *tls.Config
-	clients      *haxmap.Map[string, grpc.ClientConnInterface]
-	allowClients []string
-	router       *gin.Engine
+	tlsconfig     *tls.Config
+	clients       *haxmap.Map[string, *agent]
+	allowClients  []string
+	router        *gin.Engine
+	httpTokens    map[string]string // HTTP 接口的 bearer token -> subject，见 SetHTTPTokens
+	webTermAssets fs.FS             // 终端页面使用的 xterm.js 文件，见 SetWebTerminalAssets
+	// 跳板机，见 EnableJump
+	jump       bool
+	jumpPolicy *PolicyEngine
 }
 
 // Reverse client. 集成在客户端的反向 shell(用于 grpc server 端调用 agent 侧 shell)
@@ -26,7 +35,7 @@ func NewReverseServer(router *gin.Engine, tlscfg *tls.Config, allowClients []str
 	s := &ReverseServer{
 		tlsconfig:    tlscfg,
 		router:       router,
-		clients:      haxmap.New[string, grpc.ClientConnInterface](),
+		clients:      haxmap.New[string, *agent](),
 		allowClients: allowClients,
 	}
 	return s
@@ -43,6 +52,30 @@ func (s *ReverseServer) GetClient(id string) grpc.ClientConnInterface {
 	return conn
 }
 
+// ForwardLocal listens on listenAddr and forwards every connection through the tunnel of agent clientID
+// to remoteAddr as seen from the agent. The agent is looked up per connection, so it may connect later.
+func (s *ReverseServer) ForwardLocal(ctx context.Context, clientID, listenAddr, remoteAddr string) error {
+	return forwardLocal(ctx, listenAddr, remoteAddr, func() (grpc.ClientConnInterface, error) {
+		return s.agentChannel(clientID)
+	})
+}
+
+// ServeSOCKS runs a SOCKS5 server on listenAddr that opens connections from agent clientID.
+func (s *ReverseServer) ServeSOCKS(ctx context.Context, clientID, listenAddr string) error {
+	return serveSOCKS(ctx, listenAddr, func() (grpc.ClientConnInterface, error) {
+		return s.agentChannel(clientID)
+	})
+}
+
+// agentChannel 返回已连接 agent 的反向隧道
+func (s *ReverseServer) agentChannel(clientID string) (grpc.ClientConnInterface, error) {
+	channel := s.GetClient(clientID)
+	if channel == nil {
+		return nil, fmt.Errorf("agent %s is not connected", clientID)
+	}
+	return channel, nil
+}
+
 func contains[T comparable](elems []T, v T) bool {
 	for _, s := range elems {
 		if v == s {
@@ -67,7 +100,7 @@ func (s *ReverseServer) RegisterHandlers() {
 						//fmt.Println(x509.MarshalPKIXPublicKey(v.PublicKey))
 						slog.Info("client cert cn:", slog.String("cn", v.Subject.CommonName))
 						if !contains(s.allowClients, v.Subject.CommonName) {
-							slog.Info("非法 agent", v.Subject.CommonName)
+							slog.Info("非法 agent", slog.String("cn", v.Subject.CommonName))
 							channel.Close()
 							return
 						}
@@ -79,11 +112,11 @@ func (s *ReverseServer) RegisterHandlers() {
 				slog.Info("New Tunnel Metadata", slog.Any("metadata", md), slog.Bool("ok", ok))
 
 				if k := md.Get("rpc-transit-client-id"); len(k) > 0 {
-					s.clients.Set(k[0], channel)
+					s.clients.Set(k[0], newAgent(k[0], channel))
 				}
 				if k := md.Get("client-id"); len(k) > 0 {
 					slog.Info("新客户端:", slog.Any("k", k), slog.Any("md", md))
-					s.clients.Set(k[0], channel)
+					s.clients.Set(k[0], newAgent(k[0], channel))
 				}
 			},
 			OnReverseTunnelClose: func(channel grpctunnel.TunnelChannel) {
@@ -95,8 +128,13 @@ func (s *ReverseServer) RegisterHandlers() {
 				}
 				md, ok := metadata.FromIncomingContext(channel.Context())
 
-				if k := md.Get("client-id"); len(k) > 0 {
-					s.clients.Del(k[0])
+				// 同一 client-id 重连后旧隧道才关闭时，不删除新注册的 agent
+				for _, key := range []string{"rpc-transit-client-id", "client-id"} {
+					if k := md.Get(key); len(k) > 0 {
+						if a, ok := s.clients.Get(k[0]); ok && a.channel == channel {
+							s.clients.Del(k[0])
+						}
+					}
 				}
 			},
 		},
@@ -104,12 +142,25 @@ func (s *ReverseServer) RegisterHandlers() {
 
 	// TLS认证
 	creds := credentials.NewTLS(s.tlsconfig)
-	svr := grpc.NewServer(grpc.Creds(creds))
+	opts := []grpc.ServerOption{grpc.Creds(creds)}
+	if s.jump {
+		// 跳板机: 未注册的服务 (RemoteShell) 的调用转发给 agent
+		opts = append(opts, grpc.UnknownServiceHandler(s.proxyRemoteShell))
+	}
+	svr := grpc.NewServer(opts...)
 
 	tunnelpb.RegisterTunnelServiceServer(svr, handler.Service())
+
+	// HTTP 接口需要客户端证书或 bearer token
+	api := s.router.Group("/", s.requireHTTPIdentity)
+	api.GET("/agents", s.handleListAgents)
+	api.GET("/agents/:id", s.handleGetAgent)
+	s.router.GET("/agents/:id/terminal", s.handleWebTerminal)
+	s.router.GET("/webterm/*file", s.handleWebTerminalAsset)
+	api.POST("/exec", s.handleFanOutExec)
 	tunnelGroup := s.router.Group("/grpctunnel.v1.TunnelService")
 
-	tunnelGroup.Any("/*name", func(c *gin.Context) {
+	grpcHandler := func(c *gin.Context) {
 		_ = c.Param("name")
 		// 判断是否 grpc 请求，如果是 grpc 请求，由 grpc server 处理
 		if c.Request.ProtoMajor == 2 && strings.Contains(c.Request.Header.Get("Content-Type"), "application/grpc") {
@@ -117,7 +168,11 @@ func (s *ReverseServer) RegisterHandlers() {
 		} else {
 			slog.Info("aaaa")
 		}
-	})
+	}
+	tunnelGroup.Any("/*name", grpcHandler)
+	if s.jump {
+		s.router.Any("/"+pb.RemoteShell_ServiceDesc.ServiceName+"/*name", grpcHandler)
+	}
 }
 
 // 数组去重
@@ -12,7 +12,7 @@ import (
 	"time"
 )
 
-func tunnelRegister(ctx context.Context, conn *Connection, channelServer *grpctunnel.ReverseTunnelServer) error {
+func tunnelRegister(ctx context.Context, conn *Connection, channelServer *grpctunnel.ReverseTunnelServer, srv *rshServer) error {
 	// 注册反向隧道，对 grpc server 端提供服务.
 	if channelServer == nil {
 		tunnelStub := tunnelpb.NewTunnelServiceClient(conn)
@@ -20,12 +20,11 @@ func tunnelRegister(ctx context.Context, conn *Connection, channelServer *grpctu
 	}
 
 	// 注册 api
-	pb.RegisterRemoteShellServer(channelServer, newRSHServer("/bin/sh"))
+	pb.RegisterRemoteShellServer(channelServer, srv)
 
 	klog.Infoln("Starting Client")
 	// Create metadata and context.
-	md := metadata.Pairs("client-id", GetNodeID(), "service", "rsh")
-	ctx = metadata.NewOutgoingContext(context.Background(), md)
+	ctx = metadata.NewOutgoingContext(context.Background(), agentMetadata(srv.clientID, srv.labels))
 
 	// Open the reverse tunnel and serve requests.
 	err := retry.Do(
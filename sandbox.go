@@ -0,0 +1,156 @@
+package rsh
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v3"
+)
+
+// 沙箱支持的 namespace
+var sandboxNamespaces = []string{"mount", "pid", "net", "user", "uts", "ipc"}
+
+// SandboxConfig 是沙箱配置文件的内容:
+//
+//	default: restricted       # 未指定 profile 时使用，为空时不使用沙箱
+//	profiles:
+//	  restricted:
+//	    rootfs: /srv/rootfs/debian
+//	    pivotRoot: true
+//	    namespaces: [mount, pid, net, uts, ipc]
+//	    readOnly: [/usr/share/zoneinfo, /srv/tools:/opt/tools]
+//	    hostname: sandbox
+type SandboxConfig struct {
+	Default  string                     `yaml:"default"`
+	Profiles map[string]*SandboxProfile `yaml:"profiles"`
+}
+
+// SandboxProfile 是一个命名的沙箱环境。
+type SandboxProfile struct {
+	// Rootfs 为命令的根目录，为空时使用服务端的根目录
+	Rootfs string `yaml:"rootfs"`
+	// PivotRoot 使用 pivot_root 切换根目录并卸载原来的根目录，否则使用 chroot
+	PivotRoot bool `yaml:"pivotRoot"`
+	// Namespaces 为新建的 namespace: mount、pid、net、user、uts、ipc。
+	// 设置了 Rootfs、ReadOnly 或 pid 时总是新建 mount namespace；
+	// user namespace 中命令以 root 运行，映射到服务端上运行命令的用户
+	Namespaces []string `yaml:"namespaces"`
+	// ReadOnly 为只读 bind mount 到沙箱中的路径，"src" 或 "src:dst"，dst 为沙箱中的路径
+	ReadOnly []string `yaml:"readOnly"`
+	// Hostname 为 uts namespace 中的主机名
+	Hostname string `yaml:"hostname"`
+}
+
+// LoadSandboxConfig 读取 YAML 格式的沙箱配置文件。
+func LoadSandboxConfig(path string) (*SandboxConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &SandboxConfig{}
+	if err := yaml.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("parse sandbox config %s: %v", path, err)
+	}
+	for name, p := range c.Profiles {
+		if p == nil {
+			return nil, fmt.Errorf("sandbox config %s: profile %q is empty", path, name)
+		}
+		if err := p.normalize(); err != nil {
+			return nil, fmt.Errorf("sandbox config %s: profile %s: %v", path, name, err)
+		}
+	}
+	if _, ok := c.Profiles[c.Default]; c.Default != "" && !ok {
+		return nil, fmt.Errorf("sandbox config %s: unknown default profile %q", path, c.Default)
+	}
+	return c, nil
+}
+
+// WithSandbox 允许会话在 cfg 中的沙箱 profile 中运行，见 Input.Profile 和 PolicyRule.Profile。
+// 沙箱只支持 Linux，服务端需要以 root 运行，或在 profile 中使用 user namespace。
+func WithSandbox(cfg *SandboxConfig) ServerOption {
+	return func(o *serverOptions) {
+		o.sandbox = cfg
+	}
+}
+
+// normalize 检查 profile 并补充隐含的 mount namespace
+func (p *SandboxProfile) normalize() error {
+	for _, ns := range p.Namespaces {
+		if !slices.Contains(sandboxNamespaces, ns) {
+			return fmt.Errorf("unknown namespace %q, expected one of %s", ns, strings.Join(sandboxNamespaces, ", "))
+		}
+	}
+	if p.Rootfs != "" {
+		if !filepath.IsAbs(p.Rootfs) {
+			return fmt.Errorf("rootfs %q is not an absolute path", p.Rootfs)
+		}
+		if fi, err := os.Stat(p.Rootfs); err != nil || !fi.IsDir() {
+			return fmt.Errorf("rootfs %q is not a directory", p.Rootfs)
+		}
+	} else if p.PivotRoot {
+		return fmt.Errorf("pivotRoot requires rootfs")
+	}
+	for _, b := range p.ReadOnly {
+		src, dst := splitBind(b)
+		if !filepath.IsAbs(src) || !filepath.IsAbs(dst) {
+			return fmt.Errorf("readOnly %q: paths must be absolute", b)
+		}
+	}
+	if p.Hostname != "" && !p.has("uts") {
+		return fmt.Errorf("hostname requires the uts namespace")
+	}
+
+	if (p.Rootfs != "" || len(p.ReadOnly) > 0 || p.has("pid")) && !p.has("mount") {
+		p.Namespaces = append(p.Namespaces, "mount")
+	}
+	return nil
+}
+
+func (p *SandboxProfile) has(ns string) bool {
+	return slices.Contains(p.Namespaces, ns)
+}
+
+// splitBind 拆分 "src[:dst]"，未指定 dst 时与 src 相同
+func splitBind(b string) (src, dst string) {
+	src, dst, ok := strings.Cut(b, ":")
+	if !ok {
+		dst = src
+	}
+	return src, dst
+}
+
+// sandboxProfile 返回会话使用的沙箱 profile: 策略指定的 profile 优先，其次为 requested (Input.Profile)，
+// 都未指定时使用默认 profile。不使用沙箱时返回 nil。
+func (s *rshServer) sandboxProfile(byPolicy, requested string) (string, *SandboxProfile, error) {
+	name := requested
+	if byPolicy != "" {
+		if requested != "" && requested != byPolicy {
+			return "", nil, status.Errorf(codes.PermissionDenied, "sandbox profile %s is required by policy", byPolicy)
+		}
+		name = byPolicy
+	}
+	if s.sandbox == nil {
+		if name != "" {
+			return "", nil, status.Errorf(codes.FailedPrecondition, "sandbox profile %s: sandboxes are not enabled on this server", name)
+		}
+		return "", nil, nil
+	}
+	if name == "" {
+		name = s.sandbox.Default
+	}
+	if name == "" {
+		return "", nil, nil
+	}
+
+	p, ok := s.sandbox.Profiles[name]
+	if !ok {
+		return "", nil, status.Errorf(codes.InvalidArgument, "unknown sandbox profile %s", name)
+	}
+	return name, p, nil
+}
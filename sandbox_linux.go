@@ -0,0 +1,328 @@
+//go:build linux
+
+package rsh
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// 沙箱中的命令由服务端重新执行自身启动，argv[0] 为 sandboxInitArg0 时作为沙箱的 init 进程运行，
+// init 再次执行自身，argv[0] 为 sandboxExecArg0 的进程完成沙箱的设置后 exec 命令
+const (
+	sandboxInitArg0 = "rsh-sandbox-init"
+	sandboxExecArg0 = "rsh-sandbox-exec"
+)
+
+// sandboxSpec 是传给沙箱 init 进程的参数
+type sandboxSpec struct {
+	Profile    *SandboxProfile
+	Command    string
+	Args       []string // 包括 argv[0]
+	Dir        string
+	DefaultDir bool                // Dir 为用户的 home，沙箱中不存在时使用 /
+	Credential *syscall.Credential // 切换根目录后切换到该用户，为 nil 时不切换
+	Rlimits    []rlimit            // exec 命令前设置的 rlimit
+}
+
+func init() {
+	if len(os.Args) != 2 {
+		return
+	}
+	switch os.Args[0] {
+	case sandboxInitArg0:
+		os.Exit(runSandboxInit(os.Args[1]))
+	case sandboxExecArg0:
+		os.Exit(runSandboxExec(os.Args[1]))
+	}
+}
+
+// prepareSandbox 将 s.cmd 改为在会话的沙箱中运行: 在新的 namespace 中重新执行服务端自身，
+// 由 init 进程完成 mount 和切换根目录后再启动命令。name 为要运行的命令，在沙箱的 PATH 中查找。
+// 需要在设置 SysProcAttr 之后、启动命令之前调用。
+func (s *session) prepareSandbox(name string) error {
+	p := s.sandbox
+	if p == nil {
+		return nil
+	}
+
+	attr := s.cmd.SysProcAttr
+	spec := &sandboxSpec{
+		Profile:    p,
+		Command:    name,
+		Args:       s.cmd.Args,
+		Dir:        s.cmd.Dir,
+		DefaultDir: s.account != nil && s.cmd.Dir == s.account.home,
+		Credential: attr.Credential,
+		Rlimits:    s.limitState.rlimits,
+	}
+	for _, ns := range p.Namespaces {
+		attr.Cloneflags |= map[string]uintptr{
+			"mount": syscall.CLONE_NEWNS,
+			"pid":   syscall.CLONE_NEWPID,
+			"net":   syscall.CLONE_NEWNET,
+			"user":  syscall.CLONE_NEWUSER,
+			"uts":   syscall.CLONE_NEWUTS,
+			"ipc":   syscall.CLONE_NEWIPC,
+		}[ns]
+	}
+	if p.has("user") {
+		// init 进程在 user namespace 中以 root 运行才能 mount，命令也以 root 运行，映射到运行命令的用户
+		uid, gid := os.Getuid(), os.Getgid()
+		if attr.Credential != nil {
+			uid, gid = int(attr.Credential.Uid), int(attr.Credential.Gid)
+		}
+		attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: uid, Size: 1}}
+		attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: gid, Size: 1}}
+		// 以 namespace 中的 root 执行 init 进程，否则 exec 后失去 namespace 中的 capability
+		attr.Credential = &syscall.Credential{Uid: 0, Gid: 0, NoSetGroups: true}
+		spec.Credential = nil
+	} else {
+		// 没有 user namespace 时 root 拥有全部 capability，可以逃出 chroot
+		if p.Rootfs != "" && !p.PivotRoot && (attr.Credential == nil && os.Getuid() == 0 || attr.Credential != nil && attr.Credential.Uid == 0) {
+			return fmt.Errorf("profile runs the command as root in a chroot, use pivotRoot or a user namespace")
+		}
+		attr.Credential = nil
+	}
+
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+	// 命令在沙箱中查找，服务端找不到该命令时 exec.Cmd 记录的错误不再适用
+	s.cmd.Path = "/proc/self/exe"
+	s.cmd.Err = nil
+	s.cmd.Args = []string{sandboxInitArg0, string(data)}
+	s.cmd.Dir = ""
+	return nil
+}
+
+// runSandboxInit 在沙箱中运行命令并返回退出码。init 进程留在沙箱中回收孤儿进程，
+// 在 pid namespace 中命令不需要作为 1 号进程运行。
+// 沙箱的设置和 rlimit 由 init 启动的 runSandboxExec 完成，init 自身不受命令的 rlimit 限制。
+// 命令与 init 在同一进程组 (终端模式下为前台进程组)，服务端向整个进程组发送信号，
+// 没有 pid namespace 时结束进程组也能结束命令的子进程。init 忽略这些信号，不再转发，避免命令收到两次。
+func runSandboxInit(arg string) int {
+	// Pdeathsig 在创建子进程的线程退出时触发，固定在当前线程
+	runtime.LockOSThread()
+
+	// 命令继承 init 的信号处理方式，exec 后被捕获的信号恢复为默认处理，被忽略的信号仍然忽略，
+	// 所以使用 Notify 而不是 Ignore
+	signal.Notify(make(chan os.Signal, 1), syscall.SIGHUP, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM, syscall.SIGUSR1, syscall.SIGUSR2, syscall.SIGWINCH)
+	pid, err := syscall.ForkExec("/proc/self/exe", []string{sandboxExecArg0, arg}, &syscall.ProcAttr{
+		Env:   os.Environ(),
+		Files: []uintptr{0, 1, 2},
+		Sys:   &syscall.SysProcAttr{Pdeathsig: syscall.SIGKILL},
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rsh: sandbox: %v\n", err)
+		return execSetupExitCode
+	}
+
+	for {
+		var ws syscall.WaitStatus
+		wpid, err := syscall.Wait4(-1, &ws, 0, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "rsh: sandbox: wait: %v\n", err)
+			return execSetupExitCode
+		}
+		if wpid != pid {
+			continue
+		}
+		if ws.Signaled() {
+			return 128 + int(ws.Signal())
+		}
+		return ws.ExitStatus()
+	}
+}
+
+// runSandboxExec 完成沙箱的设置后 exec 命令，只在失败时返回退出码
+func runSandboxExec(arg string) int {
+	spec := &sandboxSpec{}
+	if err := json.Unmarshal([]byte(arg), spec); err != nil {
+		fmt.Fprintf(os.Stderr, "rsh: sandbox: %v\n", err)
+		return execSetupExitCode
+	}
+	if err := spec.setup(); err != nil {
+		fmt.Fprintf(os.Stderr, "rsh: sandbox: %v\n", err)
+		return execSetupExitCode
+	}
+
+	path, err := exec.LookPath(spec.Command)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "rsh: %v\n", err)
+		return execNotFoundExitCode
+	}
+	err = execWithLimits(path, spec.Args, spec.Credential, spec.Rlimits, true)
+	fmt.Fprintf(os.Stderr, "rsh: %s: %v\n", spec.Command, err)
+	return execFailedExitCode
+}
+
+// setup 在新的 mount namespace 中完成 bind mount、挂载 /proc，切换根目录和工作目录
+func (spec *sandboxSpec) setup() error {
+	p := spec.Profile
+	root := p.Rootfs
+
+	if p.has("mount") {
+		// 之后的 mount 不传播到服务端的 mount namespace
+		if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+			return fmt.Errorf("make / private: %v", err)
+		}
+	}
+	if root != "" {
+		// pivot_root 要求新的根目录是挂载点
+		if err := unix.Mount(root, root, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+			return fmt.Errorf("bind %s: %v", root, err)
+		}
+	}
+
+	for _, b := range p.ReadOnly {
+		src, dst := splitBind(b)
+		if err := bindReadOnly(src, filepath.Join("/", root, dst)); err != nil {
+			return fmt.Errorf("bind %s: %v", b, err)
+		}
+	}
+
+	if p.has("pid") {
+		target := filepath.Join("/", root, "proc")
+		if err := os.MkdirAll(target, 0555); err != nil {
+			return err
+		}
+		if err := unix.Mount("proc", target, "proc", unix.MS_NOSUID|unix.MS_NODEV|unix.MS_NOEXEC, ""); err != nil {
+			return fmt.Errorf("mount %s: %v", target, err)
+		}
+	}
+	if p.has("net") {
+		if err := loopbackUp(); err != nil {
+			return fmt.Errorf("bring up lo: %v", err)
+		}
+	}
+	if p.Hostname != "" {
+		if err := unix.Sethostname([]byte(p.Hostname)); err != nil {
+			return fmt.Errorf("sethostname: %v", err)
+		}
+	}
+
+	if root != "" {
+		if err := switchRoot(root, p.PivotRoot); err != nil {
+			return err
+		}
+		if spec.Dir == "" {
+			spec.Dir = "/"
+		}
+	}
+	if spec.Dir != "" {
+		if err := os.Chdir(spec.Dir); err != nil {
+			if !spec.DefaultDir {
+				return err
+			}
+			return os.Chdir("/")
+		}
+	}
+	return nil
+}
+
+// bindReadOnly 将 src 只读 bind mount 到 target，target 不存在时创建
+func bindReadOnly(src, target string) error {
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		err = os.MkdirAll(target, 0755)
+	} else if _, err = os.Stat(target); os.IsNotExist(err) {
+		if err = os.MkdirAll(filepath.Dir(target), 0755); err == nil {
+			err = os.WriteFile(target, nil, 0644)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := unix.Mount(src, target, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return err
+	}
+	// MS_REMOUNT 只作用于顶层的挂载点，mount_setattr 将 src 下的子挂载点也设为只读
+	err = unix.MountSetattr(-1, target, unix.AT_RECURSIVE, &unix.MountAttr{Attr_set: unix.MOUNT_ATTR_RDONLY})
+	if err != unix.ENOSYS {
+		return err
+	}
+	// 内核不支持 mount_setattr (5.12 之前) 时不 bind 子挂载点，只读重新挂载顶层的挂载点
+	if err := unix.Unmount(target, unix.MNT_DETACH); err != nil {
+		return err
+	}
+	if err := unix.Mount(src, target, "", unix.MS_BIND, ""); err != nil {
+		return err
+	}
+	// 重新挂载为只读时需要保留原有的 nosuid、nodev 等标志，user namespace 中不能清除这些标志
+	var st unix.Statfs_t
+	if err := unix.Statfs(target, &st); err != nil {
+		return err
+	}
+	flags := uintptr(unix.MS_BIND | unix.MS_REMOUNT | unix.MS_RDONLY)
+	for _, f := range [][2]uintptr{
+		{unix.ST_NOSUID, unix.MS_NOSUID},
+		{unix.ST_NODEV, unix.MS_NODEV},
+		{unix.ST_NOEXEC, unix.MS_NOEXEC},
+		{unix.ST_NOATIME, unix.MS_NOATIME},
+		{unix.ST_NODIRATIME, unix.MS_NODIRATIME},
+		{unix.ST_RELATIME, unix.MS_RELATIME},
+	} {
+		if uintptr(st.Flags)&f[0] != 0 {
+			flags |= f[1]
+		}
+	}
+	return unix.Mount("", target, "", flags, "")
+}
+
+// switchRoot 将根目录切换到 root，pivotRoot 时卸载原来的根目录，沙箱中无法再访问
+func switchRoot(root string, pivotRoot bool) error {
+	if !pivotRoot {
+		if err := unix.Chroot(root); err != nil {
+			return fmt.Errorf("chroot %s: %v", root, err)
+		}
+		return os.Chdir("/")
+	}
+
+	if err := os.Chdir(root); err != nil {
+		return err
+	}
+	// 将原来的根目录叠放在新的根目录之下，再将其卸载，不需要在 rootfs 中创建临时目录
+	if err := unix.PivotRoot(".", "."); err != nil {
+		return fmt.Errorf("pivot_root %s: %v", root, err)
+	}
+	if err := unix.Unmount(".", unix.MNT_DETACH); err != nil {
+		return fmt.Errorf("unmount old root: %v", err)
+	}
+	return os.Chdir("/")
+}
+
+// loopbackUp 启用新 network namespace 中的 lo
+func loopbackUp() error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+
+	ifr, err := unix.NewIfreq("lo")
+	if err != nil {
+		return err
+	}
+	if err := unix.IoctlIfreq(fd, unix.SIOCGIFFLAGS, ifr); err != nil {
+		return err
+	}
+	ifr.SetUint16(ifr.Uint16() | unix.IFF_UP)
+	return unix.IoctlIfreq(fd, unix.SIOCSIFFLAGS, ifr)
+}
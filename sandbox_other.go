@@ -0,0 +1,13 @@
+//go:build !linux
+
+package rsh
+
+import "errors"
+
+// 沙箱只支持 Linux
+func (s *session) prepareSandbox(name string) error {
+	if s.sandbox != nil {
+		return errors.New("sandbox profiles are only supported on Linux")
+	}
+	return nil
+}
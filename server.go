@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"github.com/nxsre/go-rsh/pb"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/reflection"
 	"log/slog"
 	"net"
@@ -12,16 +13,21 @@ import (
 
 // Server is the remote shell server.
 type Server struct {
+	serverOptions
 	address string
 	shell   string
 }
 
 // NewServer creates a new remote shell server.
-func NewServer(address string, shell string) *Server {
-	return &Server{
+func NewServer(address string, shell string, opts ...ServerOption) *Server {
+	s := &Server{
 		address: address,
 		shell:   shell,
 	}
+	for _, opt := range opts {
+		opt(&s.serverOptions)
+	}
+	return s
 }
 
 // Serve starts the server.
@@ -31,9 +37,20 @@ func (s *Server) Serve() error {
 		return fmt.Errorf("listen: %v", err)
 	}
 
-	g := grpc.NewServer()
+	var opts []grpc.ServerOption
+	if s.tlsconfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(s.tlsconfig)))
+	} else if s.tokens != nil {
+		slog.Warn("bearer tokens are sent in plaintext without TLS")
+	}
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(s.unaryInterceptor),
+		grpc.ChainStreamInterceptor(s.streamInterceptor),
+	)
+
+	g := grpc.NewServer(opts...)
 
-	pb.RegisterRemoteShellServer(g, newRSHServer(s.shell))
+	pb.RegisterRemoteShellServer(g, newRSHServer(s.shell, &s.serverOptions))
 
 	reflection.Register(g)
 
@@ -42,17 +59,31 @@ func (s *Server) Serve() error {
 
 type rshServer struct {
 	pb.UnimplementedRemoteShellServer
-	shell string
+	*serverOptions
+	shell    string
+	clientID string           // 作为反向隧道 agent 运行时的 client-id
+	sessions *sessionRegistry // 可分离的终端会话，未启用时为 nil
+	forwards *pendingForwards // ListenForward 接受的连接
 }
 
-func newRSHServer(shell string) *rshServer {
-	return &rshServer{shell: shell}
+func newRSHServer(shell string, opts *serverOptions) *rshServer {
+	s := &rshServer{shell: shell, serverOptions: opts, forwards: newPendingForwards()}
+	if opts.sessionIdleTimeout > 0 {
+		s.sessions = newSessionRegistry()
+	}
+	return s
 }
 
 func (s *rshServer) Session(stream pb.RemoteShell_SessionServer) error {
-	slog.Info("Opening session")
-	sess := newSession(stream, s.shell, nil)
-	if err := sess.start(); err != nil {
+	sess := newSession(stream, s)
+	slog.Info("Opening session", slog.String("session", sess.id), slog.String("identity", callerIdentity(stream.Context())))
+
+	err := sess.start()
+	// 可分离会话在结束时从 registry 移除并写入审计记录
+	if !sess.detachable {
+		s.audit(sess, err)
+	}
+	if err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
 			_ = exitErr
 		} else {
@@ -1,52 +1,122 @@
 package rsh
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"github.com/nxsre/go-rsh/pb"
 	"io"
+	"io/fs"
 	"log"
 	"log/slog"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
 
 	"github.com/creack/pty"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// 超时后发送 SIGTERM，等待该时间后仍未退出则发送 SIGKILL
+	timeoutGracePeriod = 5 * time.Second
+	// 超时退出时返回的状态码，与 GNU timeout 一致
+	timeoutExitCode = 124
+	// 进程退出后等待 pty 剩余输出的时间，后台进程可能一直持有 tty
+	outputDrainTimeout = time.Second
 )
 
 type session struct {
-	stream         pb.RemoteShell_SessionServer
+	id             string
+	stream         *sessionStream
+	server         *rshServer
 	defaultCommand string
 	defaultArgs    []string
 
 	cmd     *exec.Cmd
+	stdin   io.WriteCloser // 非终端模式下命令的 stdin
 	ptmx    *os.File
-	errPtmx *os.File // 分离 stdout, pty 包默认为合并 stderr 和 stdout 到同一个 ptmx
-
-	lock sync.Mutex
-
-	terminal  bool // 当前 session 是否打开终端
-	cmdExitC  chan int
-	errC      chan error
-	streamInC chan *pb.Input
+	errPtmx *os.File // 分离 stdout, pty 包默认为合并 stderr 和 stdout 到同一个 ptmx，Input.SeparateStderr 时使用
+	// 终端会话录像，未配置录像目录时为 nil
+	recorder *asciicastRecorder
+
+	lock     sync.Mutex
+	outputWg sync.WaitGroup // 终端模式下拷贝 pty 输出的 goroutine
+
+	// 运行命令的本地用户 (Input.User 或 Login)，为 nil 时以服务端进程的用户运行
+	account *account
+	argv0   string // 登录 shell 的 argv[0]
+	// 命令按会话的 PATH 和工作目录解析出的路径和错误，策略检查和执行使用同一个结果，登录 shell 中运行时不使用
+	path    string
+	pathErr error
+
+	sandboxName string // 会话使用的沙箱 profile，不使用沙箱时为空
+	sandbox     *SandboxProfile
+	target      *nsTarget // 进入该进程的 namespace 运行命令 (Input.TargetPid、TargetCgroup)
+
+	// 审计信息
+	identity  string
+	command   string
+	args      []string
+	startTime time.Time
+	exitCode  int
+	limit     string // 因超过资源限制被终止时为对应的限制 (Output.LimitExceeded)
+
+	terminal       bool          // 当前 session 是否打开终端
+	combinedOutput *bytes.Buffer // 非终端模式合并输出时的缓冲，命令结束后一次性返回
+	timedOut       atomic.Bool
+	wallLimited    bool       // 超时时间由服务端的 ResourceLimits.WallTime 决定
+	limitState     limitState // 资源限制的 cgroup
+	cmdExitC       chan int
+	doneC          chan struct{} // 进程退出后关闭
+	errC           chan error
+	streamInC      chan *pb.Input
+
+	// 可分离会话 (WithDetachableSessions)，命令不随连接结束，以下字段由 lock 保护
+	detachable bool
+	cancel     context.CancelFunc // 结束命令
+	buffer     *outputRing
+	attached   map[*sessionStream]*participant
+	detachedAt time.Time
+	expire     *time.Timer
+	exitOutput *pb.Output    // 命令结束后返回的 Output
+	exitedC    chan struct{} // 命令结束且输出拷贝完成后关闭
 }
 
-func newSession(stream pb.RemoteShell_SessionServer, defaultCommand string, defaultArgs []string) *session {
+func newSession(stream pb.RemoteShell_SessionServer, server *rshServer) *session {
 	return &session{
-		stream:         stream,
-		defaultCommand: defaultCommand,
-		defaultArgs:    defaultArgs,
+		id:             uuid.NewString(),
+		stream:         &sessionStream{RemoteShell_SessionServer: stream},
+		server:         server,
+		identity:       callerIdentity(stream.Context()),
+		startTime:      time.Now(),
+		exitCode:       -1,
+		defaultCommand: server.shell,
 		cmdExitC:       make(chan int),
+		doneC:          make(chan struct{}),
 		errC:           make(chan error),
 		streamInC:      make(chan *pb.Input),
 	}
 }
 
 func (s *session) start() error {
+	// 可分离会话的命令在 waitDetachable 中清理
+	defer func() {
+		if !s.detachable {
+			s.finishLimits()
+		}
+	}()
 
-	go s.consumeStream()
+	go consumeStream(s.stream, s.streamInC, s.errC)
 
 	for {
 		select {
@@ -56,16 +126,22 @@ func (s *session) start() error {
 			return nil
 
 		case exitCode := <-s.cmdExitC:
+			if s.terminal {
+				// Gracefully close pty to send all output before exiting.
+				s.waitOutput(outputDrainTimeout)
+			}
 			s.ptmx.Close()
 			s.errPtmx.Close()
 
-			if s.terminal {
-				// Gracefully close pty to send all output before exiting.
-				go io.Copy(errStreamWriter{s.stream}, s.errPtmx)
-				io.Copy(stdStreamWriter{s.stream}, s.ptmx)
+			output := &pb.Output{ExitCode: int32(exitCode), Exited: true, LimitExceeded: s.finishLimits()}
+			s.setTimedOut(output)
+			s.exitCode = int(output.ExitCode)
+			s.limit = output.LimitExceeded
+			if s.combinedOutput != nil {
+				output.CombinedOutput = s.combinedOutput.Bytes()
 			}
 
-			s.stream.Send(&pb.Output{ExitCode: int32(exitCode), Exited: true})
+			s.stream.Send(output)
 			return nil
 
 		case err := <-s.errC:
@@ -73,66 +149,145 @@ func (s *session) start() error {
 
 		case in := <-s.streamInC:
 			if in.Start {
+				var timeout time.Duration
+				if in.Timeout != "" {
+					d, err := time.ParseDuration(in.Timeout)
+					if err != nil {
+						return fmt.Errorf("parse timeout: %v", err)
+					}
+					timeout = d
+				}
+				timeout, s.wallLimited = s.server.limits.wallTimeout(timeout)
+
+				account, err := s.server.resolveAccount(s.stream.Context(), in)
+				if err != nil {
+					return err
+				}
+				s.account = account
+
+				if in.Command == "" && !in.Login {
+					in.Command = s.defaultCommand
+					in.Args = s.defaultArgs
+				}
+				s.command, s.args = in.Command, in.Args
+				if in.Login && in.Command == "" {
+					s.command = account.shell
+				}
+				path, pathErr := lookPath(s.command, commandEnv(in, account), commandDir(in, account))
+				if !in.Login {
+					s.path, s.pathErr = path, pathErr
+				}
+				decision, err := s.server.evaluate(s.stream.Context(), s.command, path, s.args, in.Terminal, nil)
+				if err != nil {
+					return err
+				}
+				s.sandboxName, s.sandbox, err = s.server.sandboxProfile(decision.Profile, in.Profile)
+				if err != nil {
+					return err
+				}
+				s.target, err = s.server.resolveTarget(s.stream.Context(), in)
+				if err != nil {
+					return err
+				}
+				if s.target != nil && s.sandbox != nil {
+					return status.Errorf(codes.InvalidArgument, "sandbox profile %s cannot be used with a target process", s.sandboxName)
+				}
+				// 授权检查原始命令，之后再改为通过登录 shell 运行
+				if in.Login {
+					in.Command, in.Args, s.argv0 = account.loginCommand(in.Command, in.Args)
+				}
+
 				s.terminal = in.Terminal
+				if s.terminal && s.server.sessions != nil {
+					return s.runDetachable(in, timeout)
+				}
 				if s.terminal {
 					slog.Info("shell session use terminal")
-					if err := s.startCommand(s.stream.Context(), in.Command, in.Args); err != nil {
+					if err := s.startCommand(s.stream.Context(), in); err != nil {
 						return fmt.Errorf("start command: %v", err)
 					}
 
 					defer s.ptmx.Close()
 
+					var stdout, stderr io.Writer = stdStreamWriter{s.stream}, errStreamWriter{s.stream}
+					if s.server.recordDir != "" {
+						if err := s.startRecording(in); err != nil {
+							s.killProcessGroup(syscall.SIGKILL)
+							return fmt.Errorf("start recording: %v", err)
+						}
+						defer s.recorder.Close()
+						stdout = io.MultiWriter(stdout, s.recorder)
+						stderr = io.MultiWriter(stderr, s.recorder)
+					}
+
 					go s.notifyOnProcessExit()
+					if timeout > 0 {
+						go s.watchTimeout(timeout)
+					}
 
-					go io.Copy(stdStreamWriter{s.stream}, s.ptmx)
-					go io.Copy(errStreamWriter{s.stream}, s.errPtmx)
+					s.copyOutput(stdout, s.ptmx)
+					if s.errPtmx != nil {
+						defer s.errPtmx.Close()
+						s.copyOutput(stderr, s.errPtmx)
+					}
 					continue
 				} else {
 					// 不需要终端时直接执行命令
 					log.Printf("DEBUG shell session no terminal, cmd: %s, %v", in.Command, in.Args)
-					s.cmd = exec.CommandContext(s.stream.Context(), in.Command, in.Args...)
+					s.cmd = s.newCmd(s.stream.Context(), in)
+					// 独立进程组，超时或连接断开时结束整个进程组
+					s.cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true, Credential: s.credential()}
+					s.prepareLimits()
+					if err := s.prepareSandbox(in.Command); err != nil {
+						return fmt.Errorf("prepare sandbox: %v", err)
+					}
+					if err := s.prepareTarget(in.Command); err != nil {
+						return err
+					}
+					if err := s.prepareRlimits(); err != nil {
+						return err
+					}
+					s.cmd.Cancel = func() error {
+						return syscall.Kill(-s.cmd.Process.Pid, syscall.SIGKILL)
+					}
+					// 后台子进程可能一直持有输出管道，进程退出后最多再等待 WaitDelay
+					s.cmd.WaitDelay = time.Second
 
 					if in.CombinedOutput {
 						slog.Info("DEBUG shell session combined output")
-						out, cmdErr := s.cmd.CombinedOutput()
-						output := &pb.Output{
-							CombinedOutput: out,
-							Exited:         true,
-						}
-
-						if cmdErr != nil {
-							if ee, ok := cmdErr.(*exec.ExitError); ok {
-								output.ExitCode = int32(ee.ExitCode())
-								s.stream.Send(output)
-								break
-							} else if ee, ok := cmdErr.(*exec.Error); ok && ee.Err == exec.ErrNotFound {
-								// 命令本身的错误不返回 error，通过 output 传递
-								return s.stream.Send(&pb.Output{ExitCode: 127, Exited: true, CombinedOutput: []byte(ee.Error())})
-							} else {
-								go func() {
-									slog.Info(cmdErr.Error())
-
-									s.errC <- cmdErr
-								}()
-							}
-							break
-						} else {
-							break
-						}
+						s.combinedOutput = &bytes.Buffer{}
+						s.cmd.Stdout = s.combinedOutput
+						s.cmd.Stderr = s.combinedOutput
 					} else {
 						s.cmd.Stdout = stdStreamWriter{
 							s.stream,
 						}
 						s.cmd.Stderr = errStreamWriter{s.stream}
+					}
+
+					if in.Stdin {
+						stdin, err := s.cmd.StdinPipe()
+						if err != nil {
+							return fmt.Errorf("stdin pipe: %v", err)
+						}
+						s.stdin = stdin
+					}
 
-						if err := s.cmd.Start(); err != nil {
-							if ee, ok := err.(*exec.Error); ok && ee.Err == exec.ErrNotFound {
-								// 命令本身的错误不返回 error，通过 output 传递
-								return s.stream.Send(&pb.Output{ExitCode: 127, Exited: true, Stderr: []byte(ee.Error())})
+					if err := s.startCmd(); err != nil {
+						if ee, ok := err.(*exec.Error); ok && ee.Err == exec.ErrNotFound {
+							// 命令本身的错误不返回 error，通过 output 传递
+							s.exitCode = 127
+							output := &pb.Output{ExitCode: 127, Exited: true, Stderr: []byte(ee.Error())}
+							if in.CombinedOutput {
+								output = &pb.Output{ExitCode: 127, Exited: true, CombinedOutput: []byte(ee.Error())}
 							}
-							return err
+							return s.stream.Send(output)
 						}
-						go s.notifyOnProcessExit()
+						return err
+					}
+					go s.notifyOnProcessExit()
+					if timeout > 0 {
+						go s.watchTimeout(timeout)
 					}
 
 					continue
@@ -146,57 +301,456 @@ func (s *session) start() error {
 	}
 }
 
-func (s *session) startCommand(ctx context.Context, command string, args []string) (err error) {
+func (s *session) startCommand(ctx context.Context, in *pb.Input) (err error) {
 	if s.cmd != nil {
 		return fmt.Errorf("command already running")
 	}
 
-	if command == "" {
-		command = s.defaultCommand
-		args = s.defaultArgs
-	}
+	command, args := in.Command, in.Args
 
 	slog.Info("Starting command", command, args)
 
-	s.cmd = exec.CommandContext(ctx, command, args...)
+	s.cmd = s.newCmd(ctx, in)
 	ptmx, tty, err := pty.Open()
 	if err != nil {
 		return fmt.Errorf("open std pty: %v", err)
 	}
+	defer tty.Close()
+	// 启动失败时关闭已打开的 pty
+	defer func() {
+		if err != nil {
+			ptmx.Close()
+			if s.errPtmx != nil {
+				s.errPtmx.Close()
+			}
+		}
+	}()
+	if err := s.chownTTY(tty); err != nil {
+		return err
+	}
 	s.cmd.Stdin = tty
 	s.cmd.Stdout = tty
 	s.cmd.Stderr = tty
 	s.ptmx = ptmx
 
-	// 分离 stdout 和 stderr (终端交互模式似乎必要分离 out 和 err，非终端模式执行命令有必要分离，用来在客户端重定向正缺输出和异常输出)
-	//errPtmx, errTty, err := pty.Open()
-	//if err != nil {
-	//	return fmt.Errorf("open err pty: %v", err)
-	//}
-	//
-	//s.cmd.Stderr = errTty
-	//s.errPtmx = errPtmx
+	// 分离 stdout 和 stderr，stderr 使用单独的 pty，程序仍然认为 stderr 是终端
+	if in.SeparateStderr {
+		errPtmx, errTty, err := pty.Open()
+		if err != nil {
+			return fmt.Errorf("open err pty: %v", err)
+		}
+		defer errTty.Close()
+		if err := s.chownTTY(errTty); err != nil {
+			errPtmx.Close()
+			return err
+		}
+
+		s.cmd.Stderr = errTty
+		s.errPtmx = errPtmx
+	}
 
 	if s.cmd.SysProcAttr == nil {
 		s.cmd.SysProcAttr = &syscall.SysProcAttr{}
 	}
 
-	// 不加 "TERM=xterm" 客户端登录会报错: "bash: cannot set terminal process group (-1): Inappropriate ioctl for device"
-	s.cmd.Env = append(os.Environ(), "TERM=xterm-256color")
 	//s.cmd.SysProcAttr.Setpgid = true
 	s.cmd.SysProcAttr.Setsid = true
 	s.cmd.SysProcAttr.Setctty = true
-	//s.cmd.SysProcAttr.Credential = &syscall.Credential{}
+	// Setsid 后进程是进程组的组长，连接断开时结束整个进程组
+	s.cmd.Cancel = func() error {
+		return syscall.Kill(-s.cmd.Process.Pid, syscall.SIGKILL)
+	}
+	s.cmd.SysProcAttr.Credential = s.credential()
+	s.prepareLimits()
+	if err := s.prepareSandbox(command); err != nil {
+		s.finishLimits()
+		return fmt.Errorf("prepare sandbox: %v", err)
+	}
+	if err := s.prepareTarget(command); err != nil {
+		s.finishLimits()
+		return err
+	}
+	if err := s.prepareRlimits(); err != nil {
+		s.finishLimits()
+		return err
+	}
 
-	if err := s.cmd.Start(); err != nil {
+	if err := s.startCmd(); err != nil {
+		s.finishLimits()
 		return fmt.Errorf("start command: %v", err)
 	}
 
 	return nil
 }
 
+// newCmd 创建运行 in 的命令，以 s.account 运行时使用该用户的环境变量，默认工作目录为用户的 home
+func (s *session) newCmd(ctx context.Context, in *pb.Input) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, in.Command, in.Args...)
+	if s.argv0 != "" {
+		cmd.Args[0] = s.argv0
+	}
+	cmd.Env = commandEnv(in, s.account)
+	cmd.Dir = commandDir(in, s.account)
+	// exec.Cmd 在服务端的 PATH 中查找命令，改为使用策略检查过的路径
+	if s.path != "" || s.pathErr != nil {
+		cmd.Path, cmd.Err = s.path, s.pathErr
+	}
+	return cmd
+}
+
+// credential 返回切换到 s.account 的 Credential，不需要切换用户时返回 nil
+func (s *session) credential() *syscall.Credential {
+	if s.account == nil {
+		return nil
+	}
+	return s.account.credential()
+}
+
+// chownTTY 将 tty 的属主改为运行命令的用户，与 sshd 一致，否则用户无法重新打开自己的终端
+func (s *session) chownTTY(tty *os.File) error {
+	cred := s.credential()
+	if cred == nil {
+		return nil
+	}
+	if err := tty.Chown(int(cred.Uid), int(cred.Gid)); err != nil {
+		return fmt.Errorf("chown tty: %v", err)
+	}
+	return tty.Chmod(0620)
+}
+
+// runDetachable 运行可分离的终端会话: 命令不随连接结束，输出保存在 ring buffer 中，重新附加时重放
+func (s *session) runDetachable(in *pb.Input, timeout time.Duration) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.detachable = true
+	s.buffer = &outputRing{size: s.server.sessionBuffer}
+	s.attached = map[*sessionStream]*participant{}
+	s.exitedC = make(chan struct{})
+
+	var stdout, stderr io.Writer = sessionOutput{s, false}, sessionOutput{s, true}
+	if s.server.recordDir != "" {
+		if err := s.startRecording(in); err != nil {
+			cancel()
+			return fmt.Errorf("start recording: %v", err)
+		}
+		stdout = io.MultiWriter(stdout, s.recorder)
+		stderr = io.MultiWriter(stderr, s.recorder)
+	}
+
+	if err := s.startCommand(ctx, in); err != nil {
+		cancel()
+		if s.recorder != nil {
+			s.recorder.Close()
+		}
+		return fmt.Errorf("start command: %v", err)
+	}
+
+	s.copyOutput(stdout, s.ptmx)
+	if s.errPtmx != nil {
+		s.copyOutput(stderr, s.errPtmx)
+	}
+
+	go s.waitDetachable()
+	if timeout > 0 {
+		go s.watchTimeout(timeout)
+	}
+
+	s.server.sessions.add(s)
+	slog.Info("Detachable session started", slog.String("session", s.id))
+
+	return s.serveAttached(s.stream, &participant{name: participantName(s.stream.Context())}, s.streamInC, s.errC)
+}
+
+// waitDetachable 等待可分离会话的命令结束，释放 pty 等资源
+func (s *session) waitDetachable() {
+	err := s.cmd.Wait()
+	slog.Info("Process completed", slog.String("session", s.id), slog.Any("process", s.cmd.ProcessState), slog.Any("err", err))
+	close(s.doneC)
+
+	s.waitOutput(outputDrainTimeout)
+	s.ptmx.Close()
+	s.errPtmx.Close()
+	if s.recorder != nil {
+		s.recorder.Close()
+	}
+	s.cancel()
+
+	output := &pb.Output{ExitCode: -1, Exited: true, LimitExceeded: s.finishLimits()}
+	if ps := s.cmd.ProcessState; ps != nil {
+		output.ExitCode = int32(ps.ExitCode())
+	}
+	s.setTimedOut(output)
+
+	s.lock.Lock()
+	s.exitCode = int(output.ExitCode)
+	s.limit = output.LimitExceeded
+	s.exitOutput = output
+	s.lock.Unlock()
+	close(s.exitedC)
+}
+
+// serveAttached 将 stream 附加到会话并处理它的输入，直到连接断开或命令结束
+func (s *session) serveAttached(stream *sessionStream, p *participant, inC <-chan *pb.Input, errC <-chan error) error {
+	s.attach(stream, p)
+	defer s.detach(stream)
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+
+		case <-p.slowC:
+			slog.Info("Session participant fell behind", slog.String("session", s.id), slog.String("participant", p.name))
+			return status.Errorf(codes.ResourceExhausted, "not reading output fast enough, session %s detached", s.id)
+
+		case <-s.exitedC:
+			// 命令结束后没有新的输出，发送完排队的输出再发送退出状态
+			s.detach(stream)
+			<-p.sentC
+			stream.Send(s.exitOutput)
+			s.server.sessions.remove(s)
+			return nil
+
+		case err := <-errC:
+			slog.Info("Session detached", slog.String("session", s.id), slog.Any("err", err))
+			return nil
+
+		case in := <-inC:
+			if in.Start {
+				return fmt.Errorf("session %s already started", s.id)
+			}
+			// 客户端的终端挂断时分离，而不是结束会话
+			if syscall.Signal(in.Signal) == syscall.SIGHUP {
+				return status.Errorf(codes.Aborted, "terminal hung up, session %s detached", s.id)
+			}
+			// 只读的客户端不能输入、发送信号或改变窗口大小
+			if p.readOnly {
+				continue
+			}
+			if err := s.processInput(in); err != nil {
+				return fmt.Errorf("processing input: %v", err)
+			}
+		}
+	}
+}
+
+// attach 返回会话 ID 并重放缓存的输出，之后的输出同时发送给 stream，并通知其他客户端。
+// 输出由每个客户端自己的 goroutine 发送，慢的客户端不会阻塞 pty 的读取和其他客户端。
+func (s *session) attach(stream *sessionStream, p *participant) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.expire != nil {
+		s.expire.Stop()
+		s.expire = nil
+	}
+
+	// 重放的输出在持有锁时复制，之后的输出进入队列，顺序不变
+	replay := append([]*pb.Output{{SessionId: s.id}}, s.buffer.outputs...)
+	p.outC = make(chan *pb.Output, participantQueueSize)
+	p.slowC = make(chan struct{})
+	p.sentC = make(chan struct{})
+	go p.sendOutput(stream, replay)
+
+	s.notify(fmt.Sprintf("%s joined (%s)", p.name, p.role()))
+	s.attached[stream] = p
+}
+
+// detach 通知其他客户端，在最后一个客户端断开后开始计算空闲超时。可以重复调用
+func (s *session) detach(stream *sessionStream) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	p, ok := s.attached[stream]
+	if !ok {
+		return
+	}
+	delete(s.attached, stream)
+	// 已经从 attached 中删除，不会再有输出进入队列
+	close(p.outC)
+	s.notify(fmt.Sprintf("%s left", p.name))
+	// 审计记录统计所有连接的字节数
+	if stream != s.stream {
+		s.stream.in.Add(stream.in.Load())
+		s.stream.out.Add(stream.out.Load())
+	}
+
+	if len(s.attached) == 0 {
+		s.detachedAt = time.Now()
+		s.expire = time.AfterFunc(s.server.sessionIdleTimeout, func() {
+			s.server.sessions.expire(s)
+		})
+	}
+}
+
+// notify 向所有附加的客户端发送通知，需要持有 s.lock
+func (s *session) notify(notice string) {
+	slog.Info("Session notice", slog.String("session", s.id), slog.String("notice", notice))
+	for _, p := range s.attached {
+		p.send(&pb.Output{Notice: notice})
+	}
+}
+
+// 每个客户端排队等待发送的输出数，超过时分离该客户端
+const participantQueueSize = 256
+
+// participant 是附加到可分离会话的一个客户端
+type participant struct {
+	name     string
+	readOnly bool
+
+	outC  chan *pb.Output // 等待发送的输出，detach 时关闭
+	slowC chan struct{}   // 队列已满时关闭，serveAttached 分离该客户端
+	slow  bool
+	sentC chan struct{} // sendOutput 结束时关闭
+}
+
+// send 将 out 放入发送队列，不阻塞。需要持有会话的 lock
+func (p *participant) send(out *pb.Output) {
+	if p.slow {
+		return
+	}
+	select {
+	case p.outC <- out:
+	default:
+		p.slow = true
+		close(p.slowC)
+	}
+}
+
+// sendOutput 先发送 replay，再发送队列中的输出，直到队列关闭或发送失败
+func (p *participant) sendOutput(stream *sessionStream, replay []*pb.Output) {
+	defer close(p.sentC)
+	for _, out := range replay {
+		if err := stream.Send(out); err != nil {
+			return
+		}
+	}
+	for out := range p.outC {
+		if err := stream.Send(out); err != nil {
+			slog.Info("Error sending session output:", slog.String("participant", p.name), slog.Any("err", err))
+			return
+		}
+	}
+}
+
+func (p *participant) role() string {
+	if p.readOnly {
+		return "read-only"
+	}
+	return "read-write"
+}
+
+// participantName 返回调用方身份，没有身份时使用客户端地址
+func participantName(ctx context.Context) string {
+	if name := callerIdentity(ctx); name != "" {
+		return name
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		return p.Addr.String()
+	}
+	return "unknown"
+}
+
+// startRecording 开始记录终端会话，录像文件名为 session id
+func (s *session) startRecording(in *pb.Input) error {
+	env := map[string]string{"SHELL": s.server.shell, "TERM": "xterm-256color"}
+	if term, ok := in.Env["TERM"]; ok {
+		env["TERM"] = term
+	}
+
+	recorder, err := newAsciicastRecorder(s.server.recordDir, s.id, s.server.recordInput,
+		strings.Join(append([]string{in.Command}, in.Args...), " "), env)
+	if err != nil {
+		return err
+	}
+	s.recorder = recorder
+	slog.Info("Recording session", slog.String("session", s.id), slog.String("path", recorder.Path()))
+	return nil
+}
+
+// commandEnv 返回命令的环境变量: 默认继承服务端的环境变量，ClearEnv 时只使用 in.Env。
+// a 不为 nil 时设置该用户的 HOME、USER、LOGNAME 和 SHELL，in.Env 中的同名变量优先。
+func commandEnv(in *pb.Input, a *account) []string {
+	// exec.Cmd 的 Env 为 nil 时继承服务端的环境变量，ClearEnv 需要非 nil 的空切片
+	env := []string{}
+	if !in.ClearEnv {
+		env = os.Environ()
+	}
+	if a != nil {
+		// exec.Cmd 对重复的变量使用最后一个值
+		env = append(env, a.env()...)
+	}
+
+	keys := make([]string, 0, len(in.Env))
+	for k := range in.Env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		env = append(env, k+"="+in.Env[k])
+	}
+
+	// 不加 "TERM=xterm" 客户端登录会报错: "bash: cannot set terminal process group (-1): Inappropriate ioctl for device"
+	if _, ok := in.Env["TERM"]; in.Terminal && !ok {
+		env = append(env, "TERM=xterm-256color")
+	}
+
+	return env
+}
+
+// commandDir 返回命令的工作目录，以 a 运行时默认为该用户的 home
+func commandDir(in *pb.Input, a *account) string {
+	if in.Dir == "" && a != nil {
+		return a.home
+	}
+	return in.Dir
+}
+
+// lookPath 与 exec.LookPath 相同，但使用命令环境变量 env 中的 PATH，env 中没有 PATH 时使用服务端的 PATH。
+// 包含 "/" 的相对路径基于命令的工作目录 dir，PATH 中的相对目录被忽略
+func lookPath(file string, env []string, dir string) (string, error) {
+	if strings.Contains(file, "/") {
+		path := file
+		if !filepath.IsAbs(path) && dir != "" {
+			path = filepath.Join(dir, path)
+		}
+		if err := findExecutable(path); err != nil {
+			return "", &exec.Error{Name: file, Err: err}
+		}
+		return path, nil
+	}
+
+	pathEnv := os.Getenv("PATH")
+	for _, kv := range env {
+		if v, ok := strings.CutPrefix(kv, "PATH="); ok {
+			pathEnv = v
+		}
+	}
+	for _, d := range filepath.SplitList(pathEnv) {
+		if !filepath.IsAbs(d) {
+			continue
+		}
+		if path := filepath.Join(d, file); findExecutable(path) == nil {
+			return path, nil
+		}
+	}
+	return "", &exec.Error{Name: file, Err: exec.ErrNotFound}
+}
+
+func findExecutable(file string) error {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	if m := fi.Mode(); m.IsDir() || m&0111 == 0 {
+		return fs.ErrPermission
+	}
+	return nil
+}
+
 func (s *session) processInput(in *pb.Input) error {
-	if s.ptmx == nil {
+	if s.cmd == nil || s.cmd.Process == nil {
 		return fmt.Errorf("received input before the process was started")
 	}
 
@@ -206,6 +760,10 @@ func (s *session) processInput(in *pb.Input) error {
 
 		switch sig {
 		case syscall.SIGWINCH:
+			// 非终端模式没有窗口大小
+			if s.ptmx == nil {
+				return nil
+			}
 			if len(in.Bytes) < 6 {
 				return fmt.Errorf("invalid input signal: %d", in.Signal)
 			}
@@ -220,12 +778,23 @@ func (s *session) processInput(in *pb.Input) error {
 			if err := pty.Setsize(s.ptmx, size); err != nil {
 				return fmt.Errorf("setsize: %v", err)
 			}
+			if s.recorder != nil {
+				s.recorder.resize(size.Cols, size.Rows)
+			}
+			if s.errPtmx != nil {
+				if err := pty.Setsize(s.errPtmx, size); err != nil {
+					return fmt.Errorf("setsize: %v", err)
+				}
+			}
 
 		default:
-			if s.cmd.Process == nil {
-				return fmt.Errorf("tried to signal nil process")
+			// 沙箱中的命令与不转发信号的 init 进程在同一进程组，发送给整个进程组
+			if s.sandbox != nil {
+				if err := syscall.Kill(-s.cmd.Process.Pid, sig); err != nil {
+					return fmt.Errorf("signal: %v", err)
+				}
+				return nil
 			}
-
 			if err := s.cmd.Process.Signal(sig); err != nil {
 				return fmt.Errorf("signal: %v", err)
 			}
@@ -234,21 +803,76 @@ func (s *session) processInput(in *pb.Input) error {
 		return nil
 	}
 
-	_, err := s.ptmx.Write(in.Bytes)
-	if err != nil {
-		return fmt.Errorf("write ptmx: %v", err)
+	if s.ptmx != nil {
+		if _, err := s.ptmx.Write(in.Bytes); err != nil {
+			return fmt.Errorf("write ptmx: %v", err)
+		}
+		if s.recorder != nil {
+			s.recorder.input(in.Bytes)
+		}
+		return nil
+	}
+
+	if s.stdin == nil {
+		return fmt.Errorf("received input but stdin is not attached")
+	}
+
+	// 命令可能已经退出或主动关闭了 stdin，丢弃剩余的输入
+	if len(in.Bytes) > 0 {
+		if _, err := s.stdin.Write(in.Bytes); err != nil {
+			slog.Info("Error writing stdin:", slog.Any("err", err))
+		}
+	}
+	if in.CloseStdin {
+		if err := s.stdin.Close(); err != nil {
+			slog.Info("Error closing stdin:", slog.Any("err", err))
+		}
 	}
 
 	return nil
 }
 
-func (s *session) consumeStream() {
+func (s *session) copyOutput(w io.Writer, r io.Reader) {
+	s.outputWg.Add(1)
+	go func() {
+		defer s.outputWg.Done()
+		io.Copy(w, r)
+	}()
+}
+
+// waitOutput 等待 copyOutput 拷贝完 pty 中剩余的输出
+func (s *session) waitOutput(timeout time.Duration) {
+	done := make(chan struct{})
+	go func() {
+		s.outputWg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		slog.Info("Timed out waiting for output")
+	}
+}
+
+// consumeStream 将 stream 的输入转发到 inC，stream 结束后不再阻塞
+func consumeStream(stream *sessionStream, inC chan<- *pb.Input, errC chan<- error) {
+	ctx := stream.Context()
 	for {
-		in, err := s.stream.Recv()
+		in, err := stream.Recv()
 		if err != nil {
-			s.errC <- fmt.Errorf("recv: %v", err)
+			select {
+			case errC <- fmt.Errorf("recv: %v", err):
+			case <-ctx.Done():
+			}
+			return
+		}
+
+		select {
+		case inC <- in:
+		case <-ctx.Done():
+			return
 		}
-		s.streamInC <- in
 	}
 }
 
@@ -260,10 +884,13 @@ func (s *session) notifyOnProcessExit() {
 		return
 	}
 	if s.cmd.Process != nil {
-		ps, err := s.cmd.Process.Wait()
+		// 使用 cmd.Wait 而不是 Process.Wait，等待输出全部拷贝完成
+		err := s.cmd.Wait()
+		ps := s.cmd.ProcessState
 		slog.Info("Process completed", slog.Any("process", ps), slog.Any("err", err))
+		close(s.doneC)
 
-		if err != nil {
+		if ps == nil {
 			s.errC <- fmt.Errorf("cmd wait: %v", err)
 			return
 		}
@@ -271,3 +898,44 @@ func (s *session) notifyOnProcessExit() {
 		s.cmdExitC <- ps.ExitCode()
 	}
 }
+
+// setTimedOut 命令因超时被终止时设置 output 的退出码，超时时间来自服务端的限制时 LimitExceeded 为 wall-time
+func (s *session) setTimedOut(output *pb.Output) {
+	if !s.timedOut.Load() {
+		return
+	}
+	output.ExitCode = timeoutExitCode
+	output.TimedOut = true
+	if s.wallLimited {
+		output.LimitExceeded = LimitWallTime
+	}
+}
+
+// watchTimeout 超时后向进程组发送 SIGTERM，超过 timeoutGracePeriod 仍未退出则发送 SIGKILL
+func (s *session) watchTimeout(timeout time.Duration) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-s.doneC:
+		return
+	case <-timer.C:
+	}
+
+	slog.Info("Command timed out", slog.Duration("timeout", timeout), slog.Int("pid", s.cmd.Process.Pid))
+	s.timedOut.Store(true)
+	s.killProcessGroup(syscall.SIGTERM)
+
+	select {
+	case <-s.doneC:
+	case <-time.After(timeoutGracePeriod):
+		s.killProcessGroup(syscall.SIGKILL)
+	}
+}
+
+// killProcessGroup 向命令所在的进程组发送信号，终端模式 Setsid、非终端模式 Setpgid，进程组 ID 即为 pid
+func (s *session) killProcessGroup(sig syscall.Signal) {
+	if err := syscall.Kill(-s.cmd.Process.Pid, sig); err != nil {
+		slog.Info("Error signaling process group:", slog.Any("signal", sig), slog.Any("err", err))
+	}
+}
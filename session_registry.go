@@ -0,0 +1,243 @@
+package rsh
+
+import (
+	"context"
+	"log/slog"
+	"slices"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/nxsre/go-rsh/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// defaultSessionBuffer 是可分离会话默认保留的输出字节数
+const defaultSessionBuffer = 256 * 1024
+
+// WithDetachableSessions 使终端会话在连接断开后继续运行，之后可以通过 Attach 重新附加。
+// 每个会话保留最近 bufferSize 字节的输出用于重放，没有客户端附加超过 idleTimeout 的会话被结束。
+func WithDetachableSessions(bufferSize int, idleTimeout time.Duration) ServerOption {
+	return func(o *serverOptions) {
+		if bufferSize <= 0 {
+			bufferSize = defaultSessionBuffer
+		}
+		o.sessionBuffer = bufferSize
+		o.sessionIdleTimeout = idleTimeout
+	}
+}
+
+// sessionRegistry 保存可分离的终端会话
+type sessionRegistry struct {
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+func newSessionRegistry() *sessionRegistry {
+	return &sessionRegistry{sessions: map[string]*session{}}
+}
+
+func (r *sessionRegistry) add(s *session) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sessions[s.id] = s
+}
+
+func (r *sessionRegistry) get(id string) *session {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.sessions[id]
+}
+
+func (r *sessionRegistry) list() []*session {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sessions := make([]*session, 0, len(r.sessions))
+	for _, s := range r.sessions {
+		sessions = append(sessions, s)
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].startTime.Before(sessions[j].startTime)
+	})
+	return sessions
+}
+
+// remove 移除会话并写入审计记录，会话已被移除时不做任何事
+func (r *sessionRegistry) remove(s *session) {
+	r.mu.Lock()
+	_, ok := r.sessions[s.id]
+	delete(r.sessions, s.id)
+	r.mu.Unlock()
+
+	if ok {
+		s.server.audit(s, nil)
+	}
+}
+
+// expire 结束空闲超时的会话
+func (r *sessionRegistry) expire(s *session) {
+	if r.get(s.id) != s {
+		return
+	}
+
+	s.lock.Lock()
+	attached := len(s.attached)
+	s.lock.Unlock()
+	if attached > 0 {
+		return
+	}
+
+	select {
+	case <-s.exitedC:
+	default:
+		slog.Info("Session idle timeout", slog.String("session", s.id))
+		s.terminate(syscall.SIGHUP)
+	}
+	r.remove(s)
+}
+
+// terminate 向会话的进程组发送 sig，超过 timeoutGracePeriod 仍未退出则发送 SIGKILL
+func (s *session) terminate(sig syscall.Signal) {
+	select {
+	case <-s.exitedC:
+		return
+	default:
+	}
+
+	s.killProcessGroup(sig)
+
+	select {
+	case <-s.exitedC:
+	case <-time.After(timeoutGracePeriod):
+		s.killProcessGroup(syscall.SIGKILL)
+		<-s.exitedC
+	}
+}
+
+func (s *session) info() *pb.SessionInfo {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	info := &pb.SessionInfo{
+		Id:        s.id,
+		Identity:  s.identity,
+		Command:   s.command,
+		Args:      s.args,
+		StartTime: s.startTime.UnixNano(),
+		Attached:  int32(len(s.attached)),
+	}
+	if len(s.attached) == 0 && !s.detachedAt.IsZero() {
+		info.DetachedAt = s.detachedAt.UnixNano()
+		info.ExpiresAt = s.detachedAt.Add(s.server.sessionIdleTimeout).UnixNano()
+	}
+	for _, p := range s.attached {
+		info.Participants = append(info.Participants, &pb.Participant{Name: p.name, ReadOnly: p.readOnly})
+	}
+	if s.exitOutput != nil {
+		info.Exited = true
+		info.ExitCode = s.exitOutput.ExitCode
+	}
+	return info
+}
+
+// findSession 返回 id 对应的会话，不检查调用方
+func (s *rshServer) findSession(id string) (*session, error) {
+	if s.sessions == nil {
+		return nil, status.Error(codes.FailedPrecondition, "detachable sessions are not enabled")
+	}
+
+	sess := s.sessions.get(id)
+	if sess == nil {
+		return nil, status.Errorf(codes.NotFound, "session %s not found", id)
+	}
+	return sess, nil
+}
+
+// lookupSession 返回调用方可以访问的会话，只有创建会话的身份可以访问
+func (s *rshServer) lookupSession(ctx context.Context, id string) (*session, error) {
+	sess, err := s.findSession(id)
+	if err != nil {
+		return nil, err
+	}
+	if sess.identity != callerIdentity(ctx) {
+		return nil, status.Errorf(codes.NotFound, "session %s not found", id)
+	}
+	return sess, nil
+}
+
+func (s *rshServer) Attach(stream pb.RemoteShell_AttachServer) error {
+	ctx := stream.Context()
+
+	in, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+
+	// 其他身份只能在策略明确允许 "@attach" 时加入，参数为会话 ID 和 "read-only" 或 "read-write"
+	sess, err := s.findSession(in.SessionId)
+	if err != nil {
+		return err
+	}
+	if sess.identity != callerIdentity(ctx) && s.policy == nil {
+		return status.Errorf(codes.NotFound, "session %s not found", in.SessionId)
+	}
+
+	p := &participant{name: participantName(ctx), readOnly: in.ReadOnly}
+	if sess.identity != callerIdentity(ctx) {
+		if err := s.authorizeExplicit(ctx, "@attach", []string{sess.id, p.role()}, true, attachRule(p.readOnly)); err != nil {
+			return err
+		}
+	}
+
+	slog.Info("Attaching session", slog.String("session", sess.id), slog.String("identity", callerIdentity(ctx)), slog.Bool("read-only", p.readOnly))
+
+	ss := &sessionStream{RemoteShell_SessionServer: stream}
+	inC, errC := make(chan *pb.Input), make(chan error)
+	go consumeStream(ss, inC, errC)
+
+	return sess.serveAttached(ss, p, inC, errC)
+}
+
+// attachRule 返回可以允许加入其他身份会话的规则: commands 中明确列出 "@attach"，
+// 不使用 default 和通配的规则；read-write 还要求规则的 args 匹配
+func attachRule(readOnly bool) func(*PolicyRule) bool {
+	return func(r *PolicyRule) bool {
+		return slices.Contains(r.Commands, "@attach") && (readOnly || len(r.Args) > 0)
+	}
+}
+
+func (s *rshServer) ListSessions(ctx context.Context, req *pb.ListSessionsRequest) (*pb.SessionList, error) {
+	if s.sessions == nil {
+		return nil, status.Error(codes.FailedPrecondition, "detachable sessions are not enabled")
+	}
+
+	identity := callerIdentity(ctx)
+	list := &pb.SessionList{}
+	for _, sess := range s.sessions.list() {
+		if sess.identity == identity {
+			list.Sessions = append(list.Sessions, sess.info())
+		}
+	}
+	return list, nil
+}
+
+func (s *rshServer) KillSession(ctx context.Context, req *pb.KillSessionRequest) (*pb.SessionInfo, error) {
+	sess, err := s.lookupSession(ctx, req.SessionId)
+	if err != nil {
+		return nil, err
+	}
+
+	sig := syscall.SIGHUP
+	if req.Signal != 0 {
+		sig = syscall.Signal(req.Signal)
+	}
+
+	slog.Info("Killing session", slog.String("session", sess.id), slog.Any("signal", sig))
+	sess.terminate(sig)
+	s.sessions.remove(sess)
+
+	return sess.info(), nil
+}
@@ -0,0 +1,143 @@
+package rsh
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/nxsre/go-rsh/pb"
+)
+
+func TestCommandEnvClearEnv(t *testing.T) {
+	t.Setenv("RSH_TEST_INHERITED", "1")
+
+	env := commandEnv(&pb.Input{ClearEnv: true}, nil)
+	if env == nil || len(env) != 0 {
+		t.Fatalf("ClearEnv without Env: got %q, want a non-nil empty environment", env)
+	}
+
+	env = commandEnv(&pb.Input{ClearEnv: true, Env: map[string]string{"B": "2", "A": "1"}}, nil)
+	if want := []string{"A=1", "B=2"}; !slices.Equal(env, want) {
+		t.Fatalf("got %q, want %q", env, want)
+	}
+
+	env = commandEnv(&pb.Input{}, nil)
+	if !slices.Contains(env, "RSH_TEST_INHERITED=1") {
+		t.Fatalf("server environment not inherited: %q", env)
+	}
+}
+
+// blockingStream 的 Send 在 release 关闭前阻塞，模拟不读取输出的客户端
+type blockingStream struct {
+	pb.RemoteShell_SessionServer
+	release chan struct{}
+	sent    chan *pb.Output
+}
+
+func (s *blockingStream) Send(out *pb.Output) error {
+	if s.release != nil {
+		<-s.release
+	}
+	s.sent <- out
+	return nil
+}
+
+func TestSessionOutputSlowParticipant(t *testing.T) {
+	slow := &blockingStream{release: make(chan struct{}), sent: make(chan *pb.Output, 1)}
+	defer close(slow.release)
+	fast := &blockingStream{sent: make(chan *pb.Output, 1)}
+	fastStream := &sessionStream{RemoteShell_SessionServer: fast}
+	sess := &session{
+		id:       "s1",
+		stream:   fastStream,
+		buffer:   &outputRing{size: 1 << 20},
+		attached: map[*sessionStream]*participant{},
+	}
+
+	fastP, slowP := &participant{name: "fast"}, &participant{name: "slow", readOnly: true}
+	sess.attach(fastStream, fastP)
+	receive := func(what string) *pb.Output {
+		t.Helper()
+		select {
+		case out := <-fast.sent:
+			return out
+		case <-time.After(5 * time.Second):
+			t.Fatalf("fast participant did not receive %s", what)
+			return nil
+		}
+	}
+	receive("the session ID")
+	sess.attach(&sessionStream{RemoteShell_SessionServer: slow}, slowP)
+	receive("the join notice")
+
+	// 慢的客户端阻塞在发送会话 ID，队列满之后的输出不能阻塞写入和其他客户端
+	for i := 0; i <= participantQueueSize; i++ {
+		done := make(chan struct{})
+		go func() {
+			sessionOutput{sess: sess}.Write([]byte("x"))
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("output %d blocked on a participant that does not read", i)
+		}
+		if out := receive("output"); string(out.Stdout) != "x" {
+			t.Fatalf("fast participant got %v, want output", out)
+		}
+	}
+
+	select {
+	case <-slowP.slowC:
+	default:
+		t.Fatal("slow participant was not marked for detaching")
+	}
+	select {
+	case <-fastP.slowC:
+		t.Fatal("fast participant was marked for detaching")
+	default:
+	}
+}
+
+func TestLookPath(t *testing.T) {
+	dir := t.TempDir()
+	for name, mode := range map[string]os.FileMode{"tool": 0755, "data": 0644} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir)
+	other := t.TempDir()
+
+	tests := []struct {
+		file string
+		env  []string
+		dir  string
+		want string
+	}{
+		{file: "tool", want: filepath.Join(dir, "tool")},
+		{file: "tool", env: []string{"PATH=" + other + ":" + dir}, want: filepath.Join(dir, "tool")},
+		{file: "tool", env: []string{"PATH=" + dir, "PATH=" + other}},
+		{file: "tool", env: []string{"PATH=."}, dir: dir},
+		{file: "data"},
+		{file: "missing"},
+		{file: "./tool", dir: dir, want: filepath.Join(dir, "tool")},
+		{file: "./tool", dir: other},
+		{file: filepath.Join(dir, "tool"), env: []string{"PATH=" + other}, want: filepath.Join(dir, "tool")},
+		{file: filepath.Join(dir, "data")},
+	}
+	for _, tt := range tests {
+		got, err := lookPath(tt.file, tt.env, tt.dir)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("lookPath(%q, %q, %q) = %q, want error", tt.file, tt.env, tt.dir, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("lookPath(%q, %q, %q) = %q, %v, want %q", tt.file, tt.env, tt.dir, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package rsh
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/nxsre/go-rsh/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// socksHandshakeTimeout 是 SOCKS5 握手的超时时间
+const socksHandshakeTimeout = 30 * time.Second
+
+// SOCKS5 应答码 (RFC 1928)
+const (
+	socksSucceeded           = 0x00
+	socksGeneralFailure      = 0x01
+	socksNotAllowed          = 0x02
+	socksHostUnreachable     = 0x04
+	socksCommandNotSupported = 0x07
+	socksAddressNotSupported = 0x08
+)
+
+// ServeSOCKS runs a SOCKS5 server on listenAddr. Every CONNECT is opened through cc,
+// so connections and DNS lookups are made from the server's network position, like ssh -D.
+// cc may be a reverse tunnel channel. It returns when ctx is done.
+func ServeSOCKS(ctx context.Context, cc grpc.ClientConnInterface, listenAddr string) error {
+	return serveSOCKS(ctx, listenAddr, func() (grpc.ClientConnInterface, error) {
+		return cc, nil
+	})
+}
+
+// serveSOCKS 与 ServeSOCKS 相同，每个连接通过 channel 获取转发使用的连接
+func serveSOCKS(ctx context.Context, listenAddr string, channel func() (grpc.ClientConnInterface, error)) error {
+	l, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	go func() {
+		<-ctx.Done()
+		l.Close()
+	}()
+
+	slog.Info("SOCKS5 proxy listening", slog.String("addr", l.Addr().String()))
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		go func() {
+			defer conn.Close()
+			if err := handleSOCKS(ctx, conn, channel); err != nil {
+				slog.Info("SOCKS5 error:", slog.String("client", conn.RemoteAddr().String()), slog.Any("err", err))
+			}
+		}()
+	}
+}
+
+// handleSOCKS 处理一个 SOCKS5 连接，只支持无认证的 CONNECT
+func handleSOCKS(ctx context.Context, conn net.Conn, channel func() (grpc.ClientConnInterface, error)) error {
+	conn.SetDeadline(time.Now().Add(socksHandshakeTimeout))
+
+	// 协商认证方法: VER NMETHODS METHODS...
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return err
+	}
+	if header[0] != 5 {
+		return fmt.Errorf("unsupported SOCKS version %d", header[0])
+	}
+	methods := make([]byte, header[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return err
+	}
+	if !contains(methods, 0x00) {
+		conn.Write([]byte{5, 0xff})
+		return fmt.Errorf("no supported authentication method")
+	}
+	if _, err := conn.Write([]byte{5, 0x00}); err != nil {
+		return err
+	}
+
+	// 请求: VER CMD RSV ATYP DST.ADDR DST.PORT
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(conn, req); err != nil {
+		return err
+	}
+	if req[1] != 1 {
+		socksReply(conn, socksCommandNotSupported)
+		return fmt.Errorf("unsupported SOCKS command %d", req[1])
+	}
+
+	var host string
+	switch req[3] {
+	case 1, 4: // IPv4, IPv6
+		ip := make(net.IP, 4)
+		if req[3] == 4 {
+			ip = make(net.IP, 16)
+		}
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return err
+		}
+		host = ip.String()
+	case 3: // 域名
+		n := make([]byte, 1)
+		if _, err := io.ReadFull(conn, n); err != nil {
+			return err
+		}
+		name := make([]byte, n[0])
+		if _, err := io.ReadFull(conn, name); err != nil {
+			return err
+		}
+		host = string(name)
+	default:
+		socksReply(conn, socksAddressNotSupported)
+		return fmt.Errorf("unsupported SOCKS address type %d", req[3])
+	}
+
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		return err
+	}
+	address := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port))))
+
+	cc, err := channel()
+	if err != nil {
+		socksReply(conn, socksGeneralFailure)
+		return err
+	}
+
+	stream, cancel, err := openForward(ctx, cc, &pb.ForwardData{Address: address})
+	if err != nil {
+		socksReply(conn, socksReplyCode(err))
+		return fmt.Errorf("connect %s: %v", address, err)
+	}
+	defer cancel()
+
+	if err := socksReply(conn, socksSucceeded); err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Time{})
+
+	return pipeForward(stream, conn, stream.CloseSend)
+}
+
+// socksReply 发送应答，绑定地址固定为 0.0.0.0:0
+func socksReply(conn net.Conn, code byte) error {
+	_, err := conn.Write([]byte{5, code, 0, 1, 0, 0, 0, 0, 0, 0})
+	return err
+}
+
+func socksReplyCode(err error) byte {
+	switch status.Code(err) {
+	case codes.PermissionDenied:
+		return socksNotAllowed
+	case codes.Unavailable:
+		return socksHostUnreachable
+	default:
+		return socksGeneralFailure
+	}
+}
@@ -1,7 +1,10 @@
 package rsh
 
 import (
+	"bytes"
 	"github.com/nxsre/go-rsh/pb"
+	"sync"
+	"sync/atomic"
 )
 
 type stdStreamWriter struct {
@@ -29,3 +32,74 @@ func (s errStreamWriter) Write(p []byte) (int, error) {
 	}
 	return n, nil
 }
+
+// sessionStream 串行化 Send (stdout、stderr 由不同的 goroutine 发送) 并统计会话收发的字节数
+type sessionStream struct {
+	pb.RemoteShell_SessionServer
+	mu  sync.Mutex
+	in  atomic.Int64
+	out atomic.Int64
+}
+
+func (s *sessionStream) Send(out *pb.Output) error {
+	s.out.Add(int64(len(out.Stdout) + len(out.Stderr) + len(out.CombinedOutput)))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.RemoteShell_SessionServer.Send(out)
+}
+
+func (s *sessionStream) Recv() (*pb.Input, error) {
+	in, err := s.RemoteShell_SessionServer.Recv()
+	if in != nil && in.Signal == 0 {
+		s.in.Add(int64(len(in.Bytes)))
+	}
+	return in, err
+}
+
+// sessionOutput 将可分离会话的输出保存到 ring buffer，并发送给所有附加的客户端
+type sessionOutput struct {
+	sess   *session
+	stderr bool
+}
+
+// Write implements the io.Writer interface
+func (w sessionOutput) Write(p []byte) (int, error) {
+	n := len(p)
+	if n == 0 {
+		return 0, nil
+	}
+
+	// io.Copy 会复用 p，保存前需要复制
+	out := &pb.Output{Stdout: bytes.Clone(p)}
+	if w.stderr {
+		out = &pb.Output{Stderr: bytes.Clone(p)}
+	}
+
+	w.sess.lock.Lock()
+	defer w.sess.lock.Unlock()
+
+	w.sess.buffer.add(out)
+	for _, p := range w.sess.attached {
+		p.send(out)
+	}
+	return n, nil
+}
+
+// outputRing 保存最近 size 字节的输出，超过时丢弃最早的输出
+type outputRing struct {
+	size    int
+	n       int
+	outputs []*pb.Output
+}
+
+func (r *outputRing) add(out *pb.Output) {
+	r.outputs = append(r.outputs, out)
+	r.n += len(out.Stdout) + len(out.Stderr)
+
+	for r.n > r.size && len(r.outputs) > 1 {
+		r.n -= len(r.outputs[0].Stdout) + len(r.outputs[0].Stderr)
+		r.outputs[0] = nil
+		r.outputs = r.outputs[1:]
+	}
+}
@@ -0,0 +1,102 @@
+package rsh
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/nxsre/go-rsh/pb"
+)
+
+// 可以进入的目标进程的 namespace (Input.TargetNamespaces)
+var targetNamespaces = []string{"mnt", "net", "pid", "uts", "ipc"}
+
+// cgroupRoot 是 cgroup 的挂载点，Input.TargetCgroup 为相对路径时相对于该目录
+const cgroupRoot = "/sys/fs/cgroup"
+
+// nsTarget 是会话要进入的目标进程的 namespace
+type nsTarget struct {
+	pid        int
+	namespaces []string
+}
+
+func (t *nsTarget) has(ns string) bool {
+	return slices.Contains(t.namespaces, ns)
+}
+
+// resolveTarget 解析 in 的目标进程，并通过 "@nsenter" 伪命令授权，参数为目标 cgroup 的绝对路径或 pid。
+// 未指定目标时返回 nil。
+func (s *rshServer) resolveTarget(ctx context.Context, in *pb.Input) (*nsTarget, error) {
+	if in.TargetPid == 0 && in.TargetCgroup == "" {
+		return nil, nil
+	}
+	if in.TargetPid != 0 && in.TargetCgroup != "" {
+		return nil, status.Error(codes.InvalidArgument, "target pid and target cgroup are mutually exclusive")
+	}
+
+	t := &nsTarget{pid: int(in.TargetPid), namespaces: in.TargetNamespaces}
+	if len(t.namespaces) == 0 {
+		t.namespaces = targetNamespaces
+	}
+	for _, ns := range t.namespaces {
+		if !slices.Contains(targetNamespaces, ns) {
+			return nil, status.Errorf(codes.InvalidArgument, "unknown namespace %q, expected one of %s", ns, strings.Join(targetNamespaces, ", "))
+		}
+	}
+
+	target := strconv.Itoa(t.pid)
+	if in.TargetCgroup != "" {
+		// 策略匹配规范化后的路径，不能通过 ".." 绕过
+		target = filepath.Clean(in.TargetCgroup)
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(cgroupRoot, target)
+		}
+		if !strings.HasPrefix(target, cgroupRoot+"/") {
+			return nil, status.Errorf(codes.InvalidArgument, "target cgroup %s is not under %s", in.TargetCgroup, cgroupRoot)
+		}
+	}
+	if err := s.authorize(ctx, "@nsenter", []string{target}, in.Terminal); err != nil {
+		return nil, err
+	}
+	if in.TargetCgroup != "" {
+		pid, err := cgroupPid(target)
+		if err != nil {
+			return nil, status.Errorf(codes.FailedPrecondition, "target cgroup %s: %v", target, err)
+		}
+		t.pid = pid
+	}
+
+	if t.pid <= 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid target pid %d", t.pid)
+	}
+	if _, err := os.Stat(fmt.Sprintf("/proc/%d", t.pid)); err != nil {
+		return nil, status.Errorf(codes.NotFound, "target process %d not found", t.pid)
+	}
+	return t, nil
+}
+
+// cgroupPid 返回 cgroup 目录 dir 中的第一个进程
+func cgroupPid(dir string) (int, error) {
+	f, err := os.Open(filepath.Join(dir, "cgroup.procs"))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	if scanner.Scan() {
+		return strconv.Atoi(strings.TrimSpace(scanner.Text()))
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("no process in cgroup")
+}
@@ -0,0 +1,121 @@
+//go:build linux
+
+package rsh
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// 目标进程中没有 PATH 时使用的默认值
+const targetDefaultPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// prepareTarget 将 s.cmd 改为在目标进程的 namespace 中运行，name 为要运行的命令。
+// Go 程序是多线程的，不能 setns 进入 mount namespace，mnt 通过 chroot 到目标进程的根目录 (/proc/PID/root) 实现，
+// 命令在该目录中查找。需要在设置 SysProcAttr 之后、startCmd 之前调用。
+func (s *session) prepareTarget(name string) error {
+	t := s.target
+	if t == nil || !t.has("mnt") {
+		return nil
+	}
+
+	root := fmt.Sprintf("/proc/%d/root", t.pid)
+	if _, err := os.Stat(root); err != nil {
+		return fmt.Errorf("target process %d: %v", t.pid, err)
+	}
+	s.cmd.SysProcAttr.Chroot = root
+
+	// exec.Cmd 在服务端的根目录中查找命令，改为在目标的根目录中查找
+	s.cmd.Err = nil
+	path, err := lookPathIn(root, name, commandPath(s.cmd.Env))
+	if err != nil {
+		s.cmd.Err = err
+	} else {
+		s.cmd.Path = path
+	}
+
+	// 未指定工作目录或默认的工作目录 (用户的 home) 在目标中不存在时使用 /
+	if s.cmd.Dir == "" {
+		s.cmd.Dir = "/"
+	} else if s.account != nil && s.cmd.Dir == s.account.home {
+		if _, err := os.Stat(filepath.Join(root, s.cmd.Dir)); err != nil {
+			s.cmd.Dir = "/"
+		}
+	}
+	return nil
+}
+
+// startCmd 启动 s.cmd，指定了目标进程时在目标的 namespace 中启动。
+// setns 只作用于当前线程，在单独锁定的线程中 setns 后启动命令，之后不解锁，线程随 goroutine 退出。
+func (s *session) startCmd() error {
+	t := s.target
+	if t == nil {
+		return s.cmd.Start()
+	}
+
+	var files []*os.File
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+	for _, ns := range t.namespaces {
+		if ns == "mnt" {
+			continue
+		}
+		f, err := os.Open(fmt.Sprintf("/proc/%d/ns/%s", t.pid, ns))
+		if err != nil {
+			return fmt.Errorf("target process %d: %v", t.pid, err)
+		}
+		files = append(files, f)
+	}
+
+	errC := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		for _, f := range files {
+			// pid namespace 只对之后创建的子进程生效
+			if err := unix.Setns(int(f.Fd()), 0); err != nil {
+				errC <- fmt.Errorf("setns %s: %v", f.Name(), err)
+				return
+			}
+		}
+		errC <- s.cmd.Start()
+	}()
+	return <-errC
+}
+
+// lookPathIn 在 root 中按 path 查找命令，返回 root 中的路径。命令包含 "/" 时不查找
+func lookPathIn(root, file, path string) (string, error) {
+	if strings.Contains(file, "/") {
+		return file, nil
+	}
+	for _, dir := range filepath.SplitList(path) {
+		if !filepath.IsAbs(dir) {
+			continue
+		}
+		p := filepath.Join(dir, file)
+		// 目标中的绝对路径符号链接在服务端无法解析，只检查链接本身
+		if fi, err := os.Lstat(filepath.Join(root, p)); err == nil && !fi.IsDir() {
+			return p, nil
+		}
+	}
+	return "", &exec.Error{Name: file, Err: exec.ErrNotFound}
+}
+
+// commandPath 返回命令环境变量中的 PATH
+func commandPath(env []string) string {
+	path := targetDefaultPath
+	for _, kv := range env {
+		if v, ok := strings.CutPrefix(kv, "PATH="); ok {
+			path = v
+		}
+	}
+	return path
+}
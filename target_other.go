@@ -0,0 +1,17 @@
+//go:build !linux
+
+package rsh
+
+import "errors"
+
+// 进入目标进程的 namespace 只支持 Linux
+func (s *session) prepareTarget(name string) error {
+	if s.target != nil {
+		return errors.New("entering the namespaces of a target process is only supported on Linux")
+	}
+	return nil
+}
+
+func (s *session) startCmd() error {
+	return s.cmd.Start()
+}
@@ -0,0 +1,222 @@
+package rsh
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/nxsre/go-rsh/pb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// UserMap 决定调用方身份可以以哪些本地用户运行命令 (Input.User)。
+type UserMap struct {
+	rules []userMapRule
+}
+
+type userMapRule struct {
+	identity string   // path.Match 通配符
+	users    []string // 本地用户名，"*" 为任意用户，"=" 为与身份同名的用户
+}
+
+// WithUserMap 允许客户端通过 Input.User 以其他本地用户运行命令，m 决定每个身份可以使用的用户。
+// 以其他用户运行需要服务端以 root 运行。
+func WithUserMap(m *UserMap) ServerOption {
+	return func(o *serverOptions) {
+		o.userMap = m
+	}
+}
+
+// LoadUserMap 读取用户映射文件，每行为 "<identity> <user>[,<user>...]"，# 开头的行为注释。
+// identity 支持 path.Match 通配符，user 为 "*" 时允许任意用户，为 "=" 时允许与身份同名的用户。
+// 身份匹配多行时，允许的用户为各行的并集。
+func LoadUserMap(file string) (*UserMap, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	m := &UserMap{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected \"<identity> <user>[,<user>...]\"", file, n)
+		}
+		if _, err := path.Match(fields[0], ""); err != nil {
+			return nil, fmt.Errorf("%s:%d: bad identity pattern %q: %v", file, n, fields[0], err)
+		}
+		m.rules = append(m.rules, userMapRule{identity: fields[0], users: strings.Split(fields[1], ",")})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Allowed reports whether identity may run commands as the local user name.
+func (m *UserMap) Allowed(identity, name string) bool {
+	for _, r := range m.rules {
+		if ok, _ := path.Match(r.identity, identity); !ok {
+			continue
+		}
+		for _, u := range r.users {
+			if u == "*" || u == name || (u == "=" && name == identity) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// account 是运行命令的本地用户
+type account struct {
+	name   string
+	uid    uint32
+	gid    uint32
+	groups []uint32 // 附加组
+	home   string
+	shell  string
+}
+
+// lookupAccount 从 passwd 和 group 数据库解析用户，name 也可以是数字 uid
+func lookupAccount(name string) (*account, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		if _, numErr := strconv.ParseUint(name, 10, 32); numErr != nil {
+			return nil, err
+		}
+		if u, err = user.LookupId(name); err != nil {
+			return nil, err
+		}
+	}
+
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("user %s: bad uid %q", name, u.Uid)
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("user %s: bad gid %q", name, u.Gid)
+	}
+	a := &account{name: u.Username, uid: uint32(uid), gid: uint32(gid), home: u.HomeDir, shell: loginShell(u.Username)}
+
+	gids, err := u.GroupIds()
+	if err != nil {
+		return nil, fmt.Errorf("user %s: groups: %v", name, err)
+	}
+	for _, g := range gids {
+		if n, err := strconv.ParseUint(g, 10, 32); err == nil {
+			a.groups = append(a.groups, uint32(n))
+		}
+	}
+	return a, nil
+}
+
+// loginShell 返回 /etc/passwd 中 name 的 shell，os/user 不提供该字段，未找到时使用 /bin/sh
+func loginShell(name string) string {
+	f, err := os.Open("/etc/passwd")
+	if err != nil {
+		return "/bin/sh"
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), ":")
+		if len(fields) == 7 && fields[0] == name && fields[6] != "" {
+			return fields[6]
+		}
+	}
+	return "/bin/sh"
+}
+
+// credential 返回切换到该用户的 Credential，与服务端进程的用户相同时返回 nil
+func (a *account) credential() *syscall.Credential {
+	if int(a.uid) == os.Getuid() && int(a.gid) == os.Getgid() {
+		return nil
+	}
+	return &syscall.Credential{Uid: a.uid, Gid: a.gid, Groups: a.groups}
+}
+
+// env 返回 passwd 中该用户的环境变量
+func (a *account) env() []string {
+	return []string{"HOME=" + a.home, "USER=" + a.name, "LOGNAME=" + a.name, "SHELL=" + a.shell}
+}
+
+// resolveAccount 检查调用方是否可以以 in.User 运行命令并解析用户。
+// 未指定 User 时以服务端进程的用户运行，只有 Login 时才需要解析当前用户，否则返回 nil。
+func (s *rshServer) resolveAccount(ctx context.Context, in *pb.Input) (*account, error) {
+	if in.User == "" {
+		if !in.Login {
+			return nil, nil
+		}
+		u, err := user.Current()
+		if err != nil {
+			return nil, status.Errorf(codes.Internal, "current user: %v", err)
+		}
+		return lookupAccount(u.Username)
+	}
+	return s.resolveUser(ctx, in.User)
+}
+
+// resolveUser 按用户映射检查调用方是否可以使用本地用户 name 并解析用户，name 为空时返回 nil
+func (s *rshServer) resolveUser(ctx context.Context, name string) (*account, error) {
+	if name == "" {
+		return nil, nil
+	}
+
+	identity := callerIdentity(ctx)
+	if current, err := user.Current(); err != nil || current.Username != name {
+		if s.userMap == nil {
+			return nil, status.Error(codes.PermissionDenied, "running commands as another user is not enabled on this server")
+		}
+		if !s.userMap.Allowed(identity, name) {
+			slog.Warn("User map denied", slog.String("identity", identity), slog.String("user", name))
+			return nil, status.Errorf(codes.PermissionDenied, "run as %s: denied by user map", name)
+		}
+	}
+
+	a, err := lookupAccount(name)
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "user %s: %v", name, err)
+	}
+	return a, nil
+}
+
+// loginCommand 返回以 a 的登录 shell 运行 command 的命令、参数和 argv[0]:
+// 未指定命令时直接启动登录 shell (argv[0] 以 - 开头)，否则通过 shell -l -c 运行
+func (a *account) loginCommand(command string, args []string) (string, []string, string) {
+	if command == "" {
+		return a.shell, nil, "-" + filepath.Base(a.shell)
+	}
+	words := make([]string, 0, len(args)+1)
+	for _, w := range append([]string{command}, args...) {
+		words = append(words, shellQuote(w))
+	}
+	return a.shell, []string{"-l", "-c", strings.Join(words, " ")}, ""
+}
+
+// shellQuote 用单引号引用 s，使 shell 将其作为一个参数
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./=:,+@%", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,87 @@
+package rsh
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUserMapAllowed(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "user-map")
+	data := `# identity  users
+alice deploy,=
+alice backup
+ops-* *
+svc-? =
+`
+	if err := os.WriteFile(file, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := LoadUserMap(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		identity, user string
+		want           bool
+	}{
+		{"alice", "deploy", true},
+		{"alice", "alice", true},
+		{"alice", "backup", true},
+		{"alice", "root", false},
+		{"ops-1", "root", true},
+		{"ops", "root", false},
+		{"svc-a", "svc-a", true},
+		{"svc-a", "svc-b", false},
+		{"svc-ab", "svc-ab", false},
+		{"bob", "bob", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		if got := m.Allowed(tt.identity, tt.user); got != tt.want {
+			t.Errorf("Allowed(%q, %q) = %v, want %v", tt.identity, tt.user, got, tt.want)
+		}
+	}
+}
+
+func TestLoadUserMapErrors(t *testing.T) {
+	for _, data := range []string{
+		"alice\n",
+		"alice deploy extra\n",
+		"[ deploy\n",
+	} {
+		file := filepath.Join(t.TempDir(), "user-map")
+		if err := os.WriteFile(file, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadUserMap(file); err == nil {
+			t.Errorf("LoadUserMap(%q) succeeded, want error", data)
+		}
+	}
+}
+
+func TestShellQuote(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"ls", "ls"},
+		{"-la", "-la"},
+		{"/usr/bin/env", "/usr/bin/env"},
+		{"k=v:1,2+@%", "k=v:1,2+@%"},
+		{"", "''"},
+		{"a b", "'a b'"},
+		{"it's", `'it'\''s'`},
+		{"$HOME", "'$HOME'"},
+		{"a;rm -rf /", "'a;rm -rf /'"},
+		{"`id`", "'`id`'"},
+		{"a\nb", "'a\nb'"},
+		{"*", "'*'"},
+		{"é", "'é'"},
+	}
+	for _, tt := range tests {
+		if got := shellQuote(tt.in); got != tt.want {
+			t.Errorf("shellQuote(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package rsh
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"syscall"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/mattn/go-shellwords"
+	"github.com/nxsre/go-rsh/pb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+//go:embed webterm.html
+var webTerminalPage []byte
+
+var webTerminalUpgrader = websocket.Upgrader{
+	ReadBufferSize:  32 * 1024,
+	WriteBufferSize: 32 * 1024,
+	// 终端页面同时发送 "rsh" 和携带 token 的子协议，选择 "rsh"，不回显 token
+	Subprotocols: []string{"rsh"},
+}
+
+// SetWebTerminalAssets serves the xterm.js files used by the web terminal page from fsys
+// under /webterm/: xterm.js, xterm.css, addon-attach.js and addon-fit.js.
+// The page loads nothing from third-party hosts; without assets it only reports that they are missing.
+func (s *ReverseServer) SetWebTerminalAssets(fsys fs.FS) {
+	s.webTermAssets = fsys
+}
+
+// handleWebTerminalAsset 处理 GET /webterm/*file
+func (s *ReverseServer) handleWebTerminalAsset(c *gin.Context) {
+	if s.webTermAssets == nil {
+		NewResult(c).ErrorCode(404, "资源未找到", nil)
+		return
+	}
+	c.FileFromFS(c.Param("file"), http.FS(s.webTermAssets))
+}
+
+// webTerminalControl 是浏览器发送的控制消息，以 JSON 文本帧发送，其他帧都作为终端输入
+type webTerminalControl struct {
+	Type   string `json:"type"`   // "resize" 或 "signal"
+	Cols   uint16 `json:"cols"`   // resize
+	Rows   uint16 `json:"rows"`   // resize
+	Signal int32  `json:"signal"` // signal，信号编号，如 2 为 SIGINT
+}
+
+// parseWebTerminalControl 解析控制消息，不是控制消息时返回 false
+func parseWebTerminalControl(data []byte) (*webTerminalControl, bool) {
+	if len(data) == 0 || data[0] != '{' {
+		return nil, false
+	}
+	var ctl webTerminalControl
+	if err := json.Unmarshal(data, &ctl); err != nil {
+		return nil, false
+	}
+	switch ctl.Type {
+	case "resize", "signal":
+		return &ctl, true
+	}
+	return nil, false
+}
+
+// handleWebTerminal 处理 GET /agents/:id/terminal: WebSocket 请求在 agent 上打开终端会话，其他请求返回终端页面。
+// 可选参数 cmd 为执行的命令，默认为 agent 的 shell，cols 和 rows 为初始窗口大小。
+// 终端页面是静态的，不需要认证；WebSocket 需要客户端证书或 token，调用方身份转发给 agent。
+func (s *ReverseServer) handleWebTerminal(c *gin.Context) {
+	if !websocket.IsWebSocketUpgrade(c.Request) {
+		c.Data(http.StatusOK, "text/html; charset=utf-8", webTerminalPage)
+		return
+	}
+	if s.requireHTTPIdentity(c); c.IsAborted() {
+		return
+	}
+	identity := c.GetString(httpIdentityKey)
+
+	clientID := c.Param("id")
+	channel := s.GetClient(clientID)
+	if channel == nil {
+		NewResult(c).ErrorCode(404, "资源未找到", nil)
+		return
+	}
+
+	in := &pb.Input{Start: true, Terminal: true}
+	if cmd := c.Query("cmd"); cmd != "" {
+		args, err := shellwords.Parse(cmd)
+		if err != nil {
+			NewResult(c).ErrorCode(100, "解析错误", err.Error())
+			return
+		}
+		if len(args) == 0 {
+			NewResult(c).ErrorCode(100, "解析错误", "empty command")
+			return
+		}
+		in.Command, in.Args = args[0], args[1:]
+	}
+
+	ws, err := webTerminalUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		slog.Info("WebSocket upgrade failed", slog.Any("err", err))
+		return
+	}
+	defer ws.Close()
+
+	slog.Info("Web terminal opened", slog.String("client-id", clientID), slog.String("identity", identity), slog.String("remote", c.Request.RemoteAddr))
+	ctx := metadata.NewOutgoingContext(c.Request.Context(), metadata.Pairs("rsh-identity", identity))
+	code, reason := serveWebTerminal(ctx, ws, channel, in, c.Query("cols"), c.Query("rows"))
+	slog.Info("Web terminal closed", slog.String("client-id", clientID), slog.String("reason", reason))
+
+	// 关闭帧的原因最长 123 字节
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+	ws.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason))
+}
+
+// serveWebTerminal 在 ws 和终端会话之间转发数据，返回关闭 WebSocket 使用的状态码和原因
+func serveWebTerminal(ctx context.Context, ws *websocket.Conn, channel grpc.ClientConnInterface, in *pb.Input, cols, rows string) (int, string) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := pb.NewRemoteShellClient(channel).Session(ctx)
+	if err != nil {
+		return websocket.CloseInternalServerErr, fmt.Sprintf("start session: %v", err)
+	}
+	if err := stream.Send(in); err != nil {
+		return websocket.CloseInternalServerErr, fmt.Sprintf("send cmd: %v", err)
+	}
+	if cols != "" && rows != "" {
+		stream.Send(resizeInput(parseUint16(cols), parseUint16(rows)))
+	}
+
+	// 浏览器 -> 会话
+	go func() {
+		defer cancel()
+		for {
+			_, data, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+			if ctl, ok := parseWebTerminalControl(data); ok {
+				switch ctl.Type {
+				case "resize":
+					err = stream.Send(resizeInput(ctl.Cols, ctl.Rows))
+				case "signal":
+					err = stream.Send(&pb.Input{Signal: ctl.Signal})
+				}
+			} else {
+				err = stream.Send(&pb.Input{Bytes: data})
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	// 会话 -> 浏览器，xterm.js 的 attach addon 直接写出二进制帧
+	for {
+		out, err := stream.Recv()
+		if err == io.EOF {
+			return websocket.CloseNormalClosure, "session closed"
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return websocket.CloseNormalClosure, "client disconnected"
+			}
+			return websocket.CloseInternalServerErr, err.Error()
+		}
+
+		var data []byte
+		data = append(data, out.Stdout...)
+		data = append(data, out.Stderr...)
+		if out.Notice != "" {
+			data = append(data, fmt.Sprintf("\r\nrsh: %s\r\n", out.Notice)...)
+		}
+		if len(data) > 0 {
+			if err := ws.WriteMessage(websocket.BinaryMessage, data); err != nil {
+				return websocket.CloseGoingAway, err.Error()
+			}
+		}
+
+		if out.Exited {
+			if out.LimitExceeded != "" {
+				return websocket.CloseNormalClosure, "killed: " + out.LimitExceeded + " limit exceeded"
+			}
+			if out.TimedOut {
+				return websocket.CloseNormalClosure, "command timed out"
+			}
+			return websocket.CloseNormalClosure, "exit status " + strconv.Itoa(int(out.ExitCode))
+		}
+	}
+}
+
+// resizeInput 返回调整终端窗口大小的输入
+func resizeInput(cols, rows uint16) *pb.Input {
+	return &pb.Input{
+		Signal: int32(syscall.SIGWINCH),
+		Bytes:  []byte(fmt.Sprintf("%d %d 0 0", cols, rows)),
+	}
+}